@@ -1,18 +1,31 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"image"
 	"image/color"
+	"image/draw"
+	"log/slog"
 	"math"
+	"math/rand"
+	"os"
 	"rd/utils"
+	"rd/utils/api"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 	"gonum.org/v1/gonum/mat"
@@ -23,53 +36,359 @@ Lenia system
 https://arxiv.org/pdf/1812.05433.pdf
 
 press 's' to save image
-press 'c' to close window
+press 'e' to export the state with its parameters
+press 'i' to invert the state
+press 'r' to start/stop recording frames
+press 'h' to toggle the history overlay
+press '3' to open/close the stacked 3D view
+press 'o' to open/close the polar world
+press 'n' to open/close the multi-species world
+press 'z' to open/close the complex world
+press 'd' to open the persistence diagram of the state
+press 'w' to save the world as HDF5 (build with -tags hdf5)
+press 'b' to show the world boundary (non wrapping boundaries only)
+press 'k' to open/close the kernel 3D surface
+press 'p' to show/hide the spectrogram panel
+press 'g' to save charts of the metrics (build with -tags plot)
+press 'v' to open the split colormap view
+press 'm' to open the mean of each cell over the next steps
+press 'f' in the kernel window to show/hide the kernel FFT
+press 'x' to clear the world (after confirmation)
+press space to draw random parameters and restart
+press the left arrow to step back to the previous state
+press ctrl+R to rotate the state by 90 degrees
+press 'c' to center the pattern
+press 'q' to close window
 */
 
 // global variables
 const width = 512
 const height = 512
 
-var simulationApp = app.New()
+// cells above this value are counted as part of a pattern
+const componentThreshold = 0.1
+
+// random parameters drawn with the space bar
+var randomMu = [2]float64{0.1, 0.4}
+var randomSigma = [2]float64{0.005, 0.05}
+var randomBeta = [2]float64{0.1, 1}
+
+const randomBetaLength = 3
+
+var paramRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// world translation controls, drift moves it by one pixel each step
+var drift atomic.Bool
+var offsetXSlider, offsetYSlider *widget.Slider
+
+// distinct patterns saved during the run (only accessed with setup locked), nil when disabled
+var catalog *utils.CreatureCatalog
+var catalogLabel *widget.Label
+
+// shown while kernels computed in the background are not swapped in yet
+var kernelLabel *widget.Label
+var pendingKernels atomic.Int32
+
+// spectrogram panel: radial power spectrum of the last states, the newest on the right
+const spectrogramBins = 64
+const spectrogramColumns = 256
+
+var spectrogramOn atomic.Bool
+var spectrogram = mat.NewDense(spectrogramBins, spectrogramColumns, nil)
+var spectrogramNext int // column written next, the oldest one
+var spectrogramLock sync.Mutex
+var spectrogramPanel *fyne.Container
+var spectrogramRaster *canvas.Raster
+
+// period of the mean of the state in steps, 0 when it does not oscillate
+var oscillationPeriod atomic.Int64
+
+// step statistics exposed by the metrics endpoint
+var stats api.StatsTracker
+
+var simulationApp fyne.App
 var kFlag bool
-var running bool = true
-var wg sync.WaitGroup
+var running atomic.Bool
 var colormap utils.ColormapButton
 var colors [][]int
+var stateRaster *canvas.Raster
+var stateWindow fyne.Window
+
+// frames recording
+const framesDir = "frames"
+
+var recording bool
+var frameCount int
+
+// frames written per step when recording, the extra ones blending two steps
+var interpFactor = 1
+var recordLock sync.Mutex
+
+// number of the current frame sequence and state of its last recorded step
+var recordSequence int
+var lastRecorded *mat.Dense
+
+// a recorded step waiting to be written, with the state before it when interpolating
+type recordedStep struct {
+	sequence, index int
+	prev, curr      *mat.Dense
+}
+
+var recordedSteps = make(chan recordedStep, 16)
+var recLabel = canvas.NewText("", color.RGBA{0xff, 0, 0, 0xff})
+
+// start/stop button and the banner shown when a breakpoint paused the simulation
+var startButton *widget.Button
+var pauseLabel = canvas.NewText("", color.RGBA{0xff, 0xa5, 0, 0xff})
+
+// streaks of the last states (only accessed with setup locked)
+var history utils.HistoryOverlay
+
+// stacked worlds displayed as a vertical xz-plane cut
+const stackSlices = 32
+const stackCoupling = 0.05
+const stackScale = 4 // height in pixels of a slice
+
+var stack utils.Stack3D
+var stackLock sync.RWMutex
+var stackWindow fyne.Window
+
+// world on a polar grid displayed as a disk
+const polarRings = 64
+const polarSectors = 256
+const polarScale = 4 // size in pixels of a radial cell
+
+var polar utils.PolarConfig
+var polarLock sync.RWMutex
+var polarWindow fyne.Window
+
+// species sharing a world, drawn as an additive mix of their colors
+var multiColors = [][3]float64{{1, 0.2, 0.2}, {0.2, 1, 0.2}, {0.2, 0.4, 1}}
+var multi utils.MultiConfig
+var multiLock sync.RWMutex
+var multiWindow fyne.Window
+
+// world of complex cells, drawn with the magnitude as brightness and the phase as hue
+var complexWorld utils.ComplexConfig
+var complexLock sync.RWMutex
+var complexWindow fyne.Window
+
+// kernel window, showing the kernel or the log magnitude of its FFT (only changed with setup locked)
+var kernelRaster *canvas.Raster
+var showSpectrum bool
+var kernelSpectrum *mat.Dense
+
+// a text shown while the mouse is over a window, as a tooltip
+type hoverTip struct {
+	widget.BaseWidget
+	content *fyne.Container
+}
+
+// kernel drawn as a 3D surface
+const surfaceSize = 500 // window size
+const surfaceGrid = 40  // number of sampled points along each axis
+
+var surfaceWindow fyne.Window
+
+// region of the state selected with ctrl+drag, copied with ctrl+C and pasted at the mouse with ctrl+V
+type regionSelector struct {
+	widget.BaseWidget
+	outline    *canvas.Rectangle
+	selecting  bool
+	start, end fyne.Position
+	mouse      fyne.Position
+}
+
+var selector *regionSelector
+var clipboard *mat.Dense
+
+// state drawn with two colormaps side by side
+var splitWindow fyne.Window
+
+// number of steps averaged by the spatial mean map
+const meanMapSteps = 100
+
+// persistence diagram window, pairs living less than the threshold are left out
+const persistenceThreshold = 0.02
+const persistenceSize = 300
+
+// parameter explorer: entropy after some steps for a grid of (Mu, Sigma)
+const explorerGrid = 12
+const explorerSize = 128 // world size of the runs, smaller than the main one to be fast
+const explorerSteps = 200
+const explorerCellSize = 32
+
+var explorerMu = [2]float64{0.1, 0.4}
+var explorerSigma = [2]float64{0.005, 0.05}
+
+// parameter sweep strip: middle column of the state after some steps for each value,
+// on a world of explorerSize, the last sweepColumns values are shown
+const sweepColumns = 256
+const sweepScale = 2
+
+// parameters a sweep can vary, by their flag name, only the fields are set so that the values can be checked first
+var sweepParams = map[string]func(c *utils.Config, v float64){
+	"m": func(c *utils.Config, v float64) { c.Mu = v },
+	"s": func(c *utils.Config, v float64) { c.Sigma = v },
+	"t": func(c *utils.Config, v float64) {
+		c.T = v
+		c.Dt = 1 / v
+	},
+	"r": func(c *utils.Config, v float64) { c.R = v },
+}
+
+// a colored cell reacting to clicks
+type explorerCell struct {
+	widget.BaseWidget
+	rect     *canvas.Rectangle
+	onTapped func()
+}
+
+// world boundary overlay (only changed with setup locked)
+const heatRingWidth = 12
+
+var showBoundary bool
+
+// available initial states, used at start and on restart
+var initStates = map[string]func(c *utils.Config){
+	"rectangles": (*utils.Config).InitState,
+	"full":       (*utils.Config).InitStateFull,
+	"fractal": func(c *utils.Config) {
+		utils.InitStateFractal(c, 5, 2, 0.5)
+	},
+	"voronoi": func(c *utils.Config) {
+		if err := utils.InitStateVoronoi(c, 40); err != nil {
+			slog.Error("initial state not drawn", "err", err)
+		}
+	},
+	"gaussians": func(c *utils.Config) {
+		utils.InitStateGaussianMixture(c, 20, c.R/2)
+	},
+}
+var initState = initStates["rectangles"]
 
 // define system parameters
 var R utils.Parameter
 var T utils.Parameter
 var Mu utils.Parameter
 var Sigma utils.Parameter
+var ClipK utils.Parameter
+var KernelAspect utils.Parameter
+var KernelAngle utils.Parameter
+var KernelAngleBias utils.Parameter
+var BetaTextField *widget.Entry
+
+// number of updates per frame, not part of the config (only written by its slider)
+var Speed utils.Parameter
+var speedMultiplier = 1.
+
+// simulation events, published by the config and the UI to their observers
+var events = utils.NewEventBus()
 
 // create and initialize a new config as current setup
-var setup utils.Config
+// it is shared by the UI and the animation so it is only accessed through its lock
+var setup *utils.SafeConfig
 
-func initParameters(R_val, T_val, Mu_val, Sigma_val float64, Beta_val []float64) {
-	setup = utils.NewConfig(width, height, R_val, T_val, Mu_val, Sigma_val, Beta_val)
+func initParameters(R_val, T_val, Mu_val, Sigma_val float64, Beta_val []float64) error {
+	c, err := utils.NewConfig(width, height, R_val, T_val, Mu_val, Sigma_val, Beta_val)
+	if err != nil {
+		return err
+	}
+	setup = utils.NewSafeConfig(c)
 	// assign each parameter to a setup variable and set the initial values
-	R.Initialize(R_val, &setup.R)
-	T.Initialize(T_val, &setup.T)
-	Mu.Initialize(Mu_val, &setup.Mu)
-	Sigma.Initialize(Sigma_val, &setup.Sigma)
+	setup.WriteState(func(c *utils.Config) {
+		R.Initialize(R_val, &c.R, setup)
+		T.Initialize(T_val, &c.T, setup)
+		Mu.Initialize(Mu_val, &c.Mu, setup)
+		Sigma.Initialize(Sigma_val, &c.Sigma, setup)
+		ClipK.Initialize(c.ClipSteepness, &c.ClipSteepness, setup)
+		KernelAspect.Initialize(c.KernelAspect, &c.KernelAspect, setup)
+		KernelAngle.Initialize(c.KernelAngle, &c.KernelAngle, setup)
+		KernelAngleBias.Initialize(c.KernelAngleBias, &c.KernelAngleBias, setup)
+		Speed.Initialize(speedMultiplier, &speedMultiplier, nil)
+	})
+	return nil
 }
 
-func displayState(i, j, w, h int) color.Color {
+func lockedRaster(pixelColor func(c *utils.Config, i, j int) color.Color) *canvas.Raster {
+	// raster drawn pixel by pixel, with setup locked for the whole image
+	return canvas.NewRaster(func(w, h int) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		setup.ReadState(func(c *utils.Config) {
+			for i := 0; i < w; i++ {
+				for j := 0; j < h; j++ {
+					img.Set(i, j, pixelColor(c, i, j))
+				}
+			}
+		})
+		return img
+	})
+}
+
+func displayState(c *utils.Config, i, j int) color.Color {
 	// update the pixels colors according to the state matrix
 	if i < width && j < height {
-		amount := setup.A.At(i, j)
+		if history.Enabled {
+			return history.GetColor(i, j)
+		}
+		amount := c.A.At(i, j)
+		if showBoundary && c.Boundary != utils.BoundaryTorus {
+			return boundaryColor(c, i, j, amount)
+		}
+		if c.Mask != nil && c.Mask.At(i, j) < 0.5 {
+			return maskColor(colormap.GetColor(utils.Clip(amount, 0, 1)))
+		}
 		return colormap.GetColor(utils.Clip(amount, 0, 1))
 	} else {
 		return color.Black
 	}
 }
 
-func displayKernel(i, j, w, h int) color.Color {
+func maskColor(base color.Color) color.Color {
+	// blend a color with a half transparent gray, for the cells outside of the mask
+	r, g, b, _ := base.RGBA()
+	return color.RGBA{
+		uint8((r>>8)/2 + 0x40),
+		uint8((g>>8)/2 + 0x40),
+		uint8((b>>8)/2 + 0x40),
+		0xff}
+}
+
+func boundaryColor(c *utils.Config, i, j int, amount float64) color.Color {
+	// draw the world edges as a thin rectangle and, when reflecting,
+	// highlight the activity close to the edges in red
+	edge := i
+	for _, d := range []int{j, width - 1 - i, height - 1 - j} {
+		if d < edge {
+			edge = d
+		}
+	}
+	if edge == 0 {
+		return color.RGBA{0xff, 0, 0, 0xff}
+	}
+	base := colormap.GetColor(utils.Clip(amount, 0, 1))
+	if c.Boundary != utils.BoundaryReflect || edge >= heatRingWidth {
+		return base
+	}
+	heat := utils.Clip(amount, 0, 1) * (1 - float64(edge)/heatRingWidth)
+	r, g, b, _ := base.RGBA()
+	return color.RGBA{
+		uint8(float64(r>>8)*(1-heat) + 255*heat),
+		uint8(float64(g>>8) * (1 - heat)),
+		uint8(float64(b>>8) * (1 - heat)),
+		0xff}
+}
+
+func displayKernel(c *utils.Config, i, j int) color.Color {
 	// display only the kernel, no need to update
-	len := int(setup.R*2 + 1)
+	len := int(c.R*2 + 1)
+	if showSpectrum && i < len && j < len {
+		// central part of the spectrum, around the zero frequency
+		rows, cols := kernelSpectrum.Dims()
+		return colormap.GetColor(kernelSpectrum.At(rows/2-len/2+i, cols/2-len/2+j))
+	}
 	if i < len && j < len {
-		amount := setup.Kernel.At(i, j) / mat.Max(setup.Kernel)
+		amount := c.Kernel.At(i, j) / mat.Max(c.Kernel)
 		col := uint8(utils.Clip(amount, 0, 1) * 255)
 		return color.RGBA{
 			col,
@@ -81,16 +400,371 @@ func displayKernel(i, j, w, h int) color.Color {
 	}
 }
 
-func animate(raster *canvas.Raster) {
+func displayStack(w, h int) image.Image {
+	// display the xz-plane going through the middle of the stack
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	stackLock.RLock()
+	defer stackLock.RUnlock()
+	for i := 0; i < w; i++ {
+		for j := 0; j < h; j++ {
+			if i < width && j < stackSlices*stackScale {
+				amount := stack.At(i, height/2, j/stackScale)
+				img.Set(i, j, colormap.GetColor(utils.Clip(amount, 0, 1)))
+			} else {
+				img.Set(i, j, color.Black)
+			}
+		}
+	}
+	return img
+}
+
+func displayPolar(w, h int) image.Image {
+	// draw the polar world as a disk centered in the window
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	polarLock.RLock()
+	defer polarLock.RUnlock()
+	for i := 0; i < w; i++ {
+		for j := 0; j < h; j++ {
+			x := (float64(i-w/2) + 0.5) / polarScale
+			y := (float64(j-h/2) + 0.5) / polarScale
+			if amount, ok := polar.AtPoint(x, y); ok {
+				img.Set(i, j, colormap.GetColor(utils.Clip(amount, 0, 1)))
+			} else {
+				img.Set(i, j, color.Black)
+			}
+		}
+	}
+	return img
+}
+
+func animate(raster *canvas.Raster, componentsLabel, energyLabel *widget.Label) {
 	// update the canvas at a regulat time tick
-	for range time.Tick(time.Millisecond * time.Duration(1000*setup.Dt)) {
-		if running {
-			wg.Add(1)
-			setup.Update()
+	// the speed multiplier runs several updates per tick (only the last one is drawn) or waits longer
+	var dt float64
+	setup.ReadState(func(c *utils.Config) {
+		dt = c.Dt
+	})
+	period := time.Millisecond * time.Duration(1000*dt)
+	for range time.Tick(period) {
+		if running.Load() {
+			speed := Speed.GetValue()
+			steps := 1
+			if speed > 1 {
+				steps = int(speed)
+			}
+			var offsetX, offsetY int
+			var energy, complexity float64
+			// the step observers (stats, recording, spectrogram, catalog) are EventStep subscribers
+			setup.WriteState(func(c *utils.Config) {
+				// a breakpoint stops the remaining updates of the frame
+				for k := 0; k < steps && running.Load(); k++ {
+					if drift.Load() {
+						c.OffsetX = (c.OffsetX + 1) % width
+						c.OffsetY = (c.OffsetY + 1) % height
+					}
+					c.Update()
+					if history.Enabled {
+						history.Push(c.A)
+					}
+				}
+				offsetX, offsetY = c.OffsetX, c.OffsetY
+				energy = c.Energy
+				complexity = utils.MDLComplexity(c)
+			})
 			raster.Refresh()
-			wg.Done()
+			if drift.Load() {
+				offsetXSlider.SetValue(float64(offsetX))
+				offsetYSlider.SetValue(float64(offsetY))
+			}
+			updateComponentsLabel(componentsLabel)
+			statsText := fmt.Sprintf("kinetic energy: %.3g, complexity: %.3f", energy, complexity)
+			if period := oscillationPeriod.Load(); period > 0 {
+				statsText += fmt.Sprintf(", period: %d steps", period)
+			}
+			energyLabel.SetText(statsText)
+			if speed < 1 {
+				time.Sleep(time.Duration(float64(period) * (1/speed - 1)))
+			}
+		}
+	}
+}
+
+func watchSpectrum() {
+	// add the spectrum of each step to the spectrogram while it is shown
+	events.Subscribe(utils.EventStep, func(e utils.Event) {
+		if spectrogramOn.Load() {
+			pushSpectrum(utils.RadialPowerSpectrum(e.Config, spectrogramBins))
+		}
+	})
+}
+
+func pushSpectrum(spectrum []float64) {
+	// replace the oldest column of the spectrogram and scroll it
+	spectrogramLock.Lock()
+	spectrogram.SetCol(spectrogramNext, spectrum)
+	spectrogramNext = (spectrogramNext + 1) % spectrogramColumns
+	spectrogramLock.Unlock()
+	spectrogramRaster.Refresh()
+}
+
+func newSpectrogramPanel() *fyne.Container {
+	// heatmap of the spectrogram, low frequencies at the bottom and time going right
+	// the log of the power is scaled between its min and max
+	spectrogramRaster = canvas.NewRaster(func(w, h int) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		spectrogramLock.Lock()
+		defer spectrogramLock.Unlock()
+		logPower := mat.NewDense(spectrogramBins, spectrogramColumns, nil)
+		logPower.Apply(func(_, _ int, v float64) float64 {
+			return math.Log1p(v)
+		}, spectrogram)
+		min, max := mat.Min(logPower), mat.Max(logPower)
+		for x := 0; x < w; x++ {
+			col := (spectrogramNext + x*spectrogramColumns/w) % spectrogramColumns
+			for y := 0; y < h; y++ {
+				v := 0.
+				if max > min {
+					v = (logPower.At((h-1-y)*spectrogramBins/h, col) - min) / (max - min)
+				}
+				img.Set(x, y, colormap.GetColor(v))
+			}
+		}
+		return img
+	})
+	spectrogramRaster.SetMinSize(fyne.NewSize(0, 128))
+	panel := container.NewVBox(widget.NewLabel("Spectrogram (spatial frequency over time)"), spectrogramRaster)
+	panel.Hide()
+	return panel
+}
+
+func toggleSpectrogram() {
+	// show the spectrogram panel and start filling it, or hide it
+	if spectrogramOn.Load() {
+		spectrogramOn.Store(false)
+		spectrogramPanel.Hide()
+		return
+	}
+	spectrogramLock.Lock()
+	spectrogram.Zero()
+	spectrogramNext = 0
+	spectrogramLock.Unlock()
+	spectrogramOn.Store(true)
+	spectrogramPanel.Show()
+}
+
+func recordFrames() {
+	// copy the state after each step while recording, writeFrames saves the frames
+	// so that the config is not locked while the files are written
+	go writeFrames()
+	events.Subscribe(utils.EventStep, func(e utils.Event) {
+		recordLock.Lock()
+		if !recording {
+			recordLock.Unlock()
+			return
+		}
+		step := recordedStep{sequence: recordSequence, index: frameCount, prev: lastRecorded, curr: mat.DenseCopyOf(e.Config.A)}
+		frameCount++
+		if interpFactor > 1 {
+			if step.prev != nil {
+				frameCount += interpFactor - 1
+			}
+			lastRecorded = step.curr
+		}
+		recordLock.Unlock()
+		recordedSteps <- step
+	})
+}
+
+func writeFrames() {
+	// save each recorded step as the next frames of its sequence
+	// with an interpolation factor, the states before and after the step are drawn
+	// with interpFactor-1 blended frames between them
+	failed := -1
+	for step := range recordedSteps {
+		if step.sequence == failed {
+			continue
+		}
+		frames := []*mat.Dense{step.curr}
+		if interpFactor > 1 && step.prev != nil {
+			frames = frames[:0]
+			for k := 1; k <= interpFactor; k++ {
+				frames = append(frames, utils.InterpolateFrame(step.prev, step.curr, float64(k)/float64(interpFactor)))
+			}
+		}
+		var err error
+		for k := 0; k < len(frames) && err == nil; k++ {
+			err = utils.SaveStateFrame(frames[k], colormap, step.index+k, framesDir)
+		}
+		recordLock.Lock()
+		if step.sequence == recordSequence && recording {
+			if err != nil {
+				slog.Error("recording failed", "err", err)
+				failed = step.sequence
+				recording = false
+				recLabel.Text = ""
+			} else {
+				recLabel.Text = fmt.Sprintf("REC %06d", step.index+len(frames))
+			}
+			recLabel.Refresh()
+		}
+		recordLock.Unlock()
+	}
+}
+
+func toggleRecording() {
+	// start a new frame sequence or stop the current one
+	recordLock.Lock()
+	defer recordLock.Unlock()
+	recording = !recording
+	if recording {
+		recordSequence++
+		frameCount = 0
+		lastRecorded = nil
+		recLabel.Text = fmt.Sprintf("REC %06d", frameCount)
+	} else {
+		recLabel.Text = ""
+	}
+	recLabel.Refresh()
+}
+
+func displayMulti(w, h int) image.Image {
+	// draw the species with their colors, pixel (x, y) being the cell (x, y)
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	multiLock.RLock()
+	defer multiLock.RUnlock()
+	for i := 0; i < w; i++ {
+		for j := 0; j < h; j++ {
+			if i < width && j < height {
+				img.Set(i, j, multi.GetColor(i, j))
+			} else {
+				img.Set(i, j, color.Black)
+			}
+		}
+	}
+	return img
+}
+
+func displayComplex(w, h int) image.Image {
+	// draw the complex world, pixel (x, y) being the cell (x, y)
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	complexLock.RLock()
+	defer complexLock.RUnlock()
+	for i := 0; i < w; i++ {
+		for j := 0; j < h; j++ {
+			if i < width && j < height {
+				img.Set(i, j, complexWorld.GetColor(i, j))
+			} else {
+				img.Set(i, j, color.Black)
+			}
 		}
 	}
+	return img
+}
+
+func animateStack(raster *canvas.Raster, stop chan struct{}) {
+	// update the stack at the same rate as the main simulation until stop is closed
+	var dt float64
+	setup.ReadState(func(c *utils.Config) {
+		dt = c.Dt
+	})
+	ticker := time.NewTicker(time.Millisecond * time.Duration(1000*dt))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if running.Load() {
+				stackLock.Lock()
+				stack.Update()
+				stackLock.Unlock()
+				raster.Refresh()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func animatePolar(raster *canvas.Raster, stop chan struct{}) {
+	// update the polar world at the same rate as the main simulation until stop is closed
+	var dt float64
+	setup.ReadState(func(c *utils.Config) {
+		dt = c.Dt
+	})
+	ticker := time.NewTicker(time.Millisecond * time.Duration(1000*dt))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if running.Load() {
+				polarLock.Lock()
+				polar.Update()
+				polarLock.Unlock()
+				raster.Refresh()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func animateMulti(raster *canvas.Raster, stop chan struct{}) {
+	// update the species at the same rate as the main simulation until stop is closed
+	var dt float64
+	setup.ReadState(func(c *utils.Config) {
+		dt = c.Dt
+	})
+	ticker := time.NewTicker(time.Millisecond * time.Duration(1000*dt))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if running.Load() {
+				multiLock.Lock()
+				multi.Update()
+				multiLock.Unlock()
+				raster.Refresh()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func animateComplex(raster *canvas.Raster, stop chan struct{}) {
+	// update the complex world at the same rate as the main simulation until stop is closed
+	var dt float64
+	setup.ReadState(func(c *utils.Config) {
+		dt = c.Dt
+	})
+	ticker := time.NewTicker(time.Millisecond * time.Duration(1000*dt))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if running.Load() {
+				complexLock.Lock()
+				complexWorld.Update()
+				complexLock.Unlock()
+				raster.Refresh()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func updateComponentsLabel(label *widget.Label) {
+	// display the number of patterns and the size of the largest one (0 patterns means extinction)
+	var count int
+	var sizes []int
+	setup.ReadState(func(c *utils.Config) {
+		count, sizes = utils.CountComponents(c, componentThreshold)
+	})
+	largest := 0
+	if count > 0 {
+		largest = sizes[count-1]
+	}
+	label.SetText(fmt.Sprintf("components: %d, largest: %d", count, largest))
 }
 
 func getMargin(length int) float32 {
@@ -108,113 +782,1520 @@ func initWindow(title string, winWidth, winHeight float32) fyne.Window {
 
 func StartButton() *widget.Button {
 	// generate a start/stop button
-	startButton := widget.NewButton("stop", nil)
+	startButton = widget.NewButton("stop", nil)
 	// on click, toggle the 'running' bool and update text
 	startButton.OnTapped = func() {
-		running = !running
-		if running {
-			startButton.Text = "stop"
-		} else {
-			startButton.Text = "start"
-		}
-		startButton.Refresh()
+		setRunning(!running.Load())
 	}
 	return startButton
 }
 
+func setRunning(run bool) {
+	// start or stop the simulation, the button and the pause banner follow
+	running.Store(run)
+	if startButton == nil {
+		return
+	}
+	if run {
+		startButton.Text = "stop"
+		pauseLabel.Text = ""
+		pauseLabel.Refresh()
+	} else {
+		startButton.Text = "start"
+	}
+	startButton.Refresh()
+}
+
+func editState(raster *canvas.Raster, edit func(c *utils.Config)) {
+	// modify the state between two updates
+	setup.WriteState(edit)
+	raster.Refresh()
+}
+
 func RestartButton(raster *canvas.Raster) *widget.Button {
 	// generate a button to restart the simulation
 	restartButton := widget.NewButton("restart", func() {
-		// stop simulation
-		wasRunning := running
-		running = false
-		// wait for last update to complete
-		wg.Wait()
-		// set a new initial state
-		setup.A = mat.NewDense(width, height, nil)
-		setup.InitState()
-		raster.Refresh()
-		// resume the simulation (keep previous running state)
-		running = wasRunning
+		editState(raster, func(c *utils.Config) {
+			// set a new initial state
+			c.A = mat.NewDense(width, height, nil)
+			initState(c)
+			c.Step = 0
+			c.ClearHistory()
+		})
+		events.Publish(utils.Event{Type: utils.EventReset})
 	})
 	return restartButton
 }
 
+func offsetControls() *fyne.Container {
+	// sliders translating the world and a checkbox to make it drift
+	offsetSlider := func(label string, max int, set func(c *utils.Config, v int)) (*widget.Slider, *fyne.Container) {
+		slider := widget.NewSlider(0, float64(max-1))
+		valueLabel := widget.NewLabel("0")
+		slider.OnChanged = func(v float64) {
+			valueLabel.SetText(strconv.Itoa(int(v)))
+		}
+		slider.OnChangeEnded = func(v float64) {
+			setup.WriteState(func(c *utils.Config) {
+				set(c, int(v))
+			})
+		}
+		return slider, container.NewBorder(nil, nil, widget.NewLabel(label), valueLabel, slider)
+	}
+	var xBox, yBox *fyne.Container
+	offsetXSlider, xBox = offsetSlider("Offset x", width, func(c *utils.Config, v int) {
+		c.OffsetX = v
+	})
+	offsetYSlider, yBox = offsetSlider("Offset y", height, func(c *utils.Config, v int) {
+		c.OffsetY = v
+	})
+	driftCheck := widget.NewCheck("drift", func(checked bool) {
+		drift.Store(checked)
+	})
+	return container.NewVBox(xBox, yBox, driftCheck)
+}
+
+func ringEditor() *utils.KernelRingEditor {
+	// kernel rings edited with the mouse, the R slider and beta field follow (see followParamChanges)
+	return utils.NewKernelRingEditor(setup, 200)
+}
+
+func betaControls() *fyne.Container {
+	// text field editing beta, the kernel is computed again on enter
+	BetaTextField = widget.NewEntry()
+	setup.ReadState(func(c *utils.Config) {
+		BetaTextField.SetText(utils.BetaToFlag(c.Beta))
+	})
+	errorLabel := widget.NewLabel("")
+	errorLabel.Hide()
+	BetaTextField.OnSubmitted = func(text string) {
+		beta, err := utils.ValidateBeta(text)
+		if err != nil {
+			errorLabel.SetText(err.Error())
+			errorLabel.Show()
+			return
+		}
+		errorLabel.Hide()
+		setup.WriteState(func(c *utils.Config) {
+			c.Beta = beta
+			c.ComputeKernel()
+		})
+		slog.Info("parameter changed", "name", "Beta", "value", beta)
+	}
+	return container.NewVBox(
+		container.NewBorder(nil, nil, widget.NewLabel("Beta"), nil, BetaTextField),
+		errorLabel)
+}
+
+func recomputeKernel(*utils.Config) {
+	// slider callback: compute the kernel in the background instead of in the UI thread
+	// (the config is locked, the computation starts once it is released)
+	if pendingKernels.Add(1) == 1 {
+		kernelLabel.Show()
+	}
+	done := make(chan struct{})
+	setup.ComputeKernelAsync(done)
+	go func() {
+		<-done
+		if pendingKernels.Add(-1) == 0 {
+			kernelLabel.Hide()
+		}
+	}()
+}
+
 func leniaWindow() fyne.Window {
 	// build the lenia app
 	// define window size
 	winWidth := 2 * (width - getMargin(width))
 	winHeight := height - getMargin(height)
 	w := initWindow("Lenia State", winWidth, winHeight)
+	stateWindow = w
 	// raster is the pixel matrix and its update function
-	raster := canvas.NewRasterWithPixels(displayState)
+	raster := lockedRaster(displayState)
+	stateRaster = raster
 	// colormap
-	colormap = utils.CreateColormapButton(&colors, raster)
+	colormap = utils.CreateColormapButton(&colors, raster, setup)
 	// buttons
 	buttons := container.New(layout.NewHBoxLayout(),
 		StartButton(), RestartButton(raster))
+	// live pattern analysis
+	componentsLabel := widget.NewLabel("")
+	updateComponentsLabel(componentsLabel)
+	energyLabel := widget.NewLabel("")
+	catalogLabel = widget.NewLabel("")
+	kernelLabel = widget.NewLabel("recomputing…")
+	spectrogramPanel = newSpectrogramPanel()
+	kernelLabel.Hide()
 
 	// sliders and control panel
+	aspectBox := KernelAspect.GetSliderBox(0.25, 4, 0.05, "Kernel aspect", recomputeKernel)
+	angleBox := KernelAngle.GetSliderBox(0, math.Pi, 0.01, "Kernel angle", recomputeKernel)
 	controls := container.New(layout.NewVBoxLayout(),
-		R.GetSliderBox(0, 200, 1, "R", &setup),
-		T.GetSliderBox(0, 100, 1, "T", &setup),
+		R.GetSliderBox(0, 200, 1, "R", recomputeKernel),
+		T.GetSliderBox(0, 100, 1, "T", func(c *utils.Config) {
+			c.Dt = 1 / c.T
+		}),
 		Mu.GetSliderBox(0, 1, 0.001, "Mu", nil),
 		Sigma.GetSliderBox(0, 1, 0.001, "Sigma", nil),
+		betaControls(),
+		ringEditor(),
+		aspectBox,
+		angleBox,
+		KernelAngleBias.GetSliderBox(0, 2*math.Pi, 0.01, "Kernel bias", recomputeKernel),
+		kernelLabel,
+		ClipK.GetSliderBox(1, 30, 0.5, "Soft clip k", nil),
+		Speed.GetSliderBox(0.1, 10, 0.1, "Speed", nil),
+		offsetControls(),
 		buttons,
-		colormap.Buttons)
-	// 2 columns: lenia state and parameters
-	grid := container.New(layout.NewGridLayout(2), raster, controls)
+		colormap.Buttons,
+		colormap.PerceptualCheck(),
+		colormap.HSVSettings(),
+		componentsLabel,
+		energyLabel,
+		catalogLabel,
+		spectrogramPanel,
+		pauseLabel,
+		recLabel)
+	// the hex grid kernel can not be stretched
+	setup.ReadState(func(c *utils.Config) {
+		if c.GridType == utils.GridHex {
+			aspectBox.Hide()
+			angleBox.Hide()
+		}
+	})
+	// 2 columns: lenia state and parameters (scrolling when they do not fit)
+	selector = newRegionSelector()
+	grid := container.New(layout.NewGridLayout(2), container.NewStack(raster, selector), container.NewVScroll(controls))
 	w.SetContent(grid)
+	// quarter turn of the state with ctrl+R (r alone records frames)
+	w.Canvas().AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyR, Modifier: fyne.KeyModifierControl}, func(fyne.Shortcut) {
+		editState(raster, func(c *utils.Config) {
+			utils.RotateState(c, 90)
+		})
+	})
+	// copy and paste of regions
+	// (ctrl+C and ctrl+V are reported as the standard copy and paste shortcuts)
+	w.Canvas().AddShortcut(&fyne.ShortcutCopy{}, func(fyne.Shortcut) {
+		selector.copy()
+	})
+	w.Canvas().AddShortcut(&fyne.ShortcutPaste{}, func(fyne.Shortcut) {
+		selector.paste(raster)
+	})
+	// menu
+	w.SetMainMenu(fyne.NewMainMenu(fyne.NewMenu("Tools",
+		fyne.NewMenuItem("Parameter explorer", func() {
+			if w := explorerWindow(); w != nil {
+				w.Show()
+			}
+		}),
+		fyne.NewMenuItem("Mu sweep", func() {
+			values := make([]float64, sweepColumns)
+			for k := range values {
+				values[k] = utils.GridValue(explorerMu, k, len(values))
+			}
+			if w := SweepDisplay("m", values, explorerSteps); w != nil {
+				w.Show()
+			}
+		}))))
 	// launch animation
-	go animate(raster)
+	go animate(raster, componentsLabel, energyLabel)
 	return w
 }
 
 func kernelWindow() fyne.Window {
 	// build the kernel display
-	winWidth := 2*float32(setup.R) + 1
+	var winWidth float32
+	setup.ReadState(func(c *utils.Config) {
+		winWidth = 2*float32(c.R) + 1
+	})
 	winMargin := getMargin(int(winWidth))
 	w := initWindow("Lenia Kernel", winWidth-winMargin, winWidth-winMargin)
-	raster := canvas.NewRasterWithPixels(displayKernel)
+	raster := lockedRaster(displayKernel)
+	kernelRaster = raster
+	colormap = utils.CreateColormapButton(&colors, raster, setup)
+	// kernel diagnostics shown while hovering the window
+	var diagnostics utils.KernelDiagnostics
+	setup.ReadState(func(c *utils.Config) {
+		diagnostics = utils.DiagnoseKernel(c)
+	})
+	w.SetContent(container.NewStack(raster, newHoverTip(diagnostics.String())))
+	return w
+}
+
+func newHoverTip(text string) *hoverTip {
+	// text over a dark background, hidden until the mouse enters
+	label := widget.NewLabel(text)
+	background := canvas.NewRectangle(color.NRGBA{0, 0, 0, 0xb0})
+	tip := &hoverTip{content: container.NewVBox(container.NewStack(background, label))}
+	tip.content.Hide()
+	tip.ExtendBaseWidget(tip)
+	return tip
+}
+
+func (t *hoverTip) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(t.content)
+}
+
+func (t *hoverTip) MouseIn(*desktop.MouseEvent) {
+	t.content.Show()
+}
+
+func (t *hoverTip) MouseMoved(*desktop.MouseEvent) {}
+
+func (t *hoverTip) MouseOut() {
+	t.content.Hide()
+}
+
+func kernelSurface(K *mat.Dense) []fyne.CanvasObject {
+	// wireframe of the kernel seen in isometric projection, shaded by height
+	size, _ := K.Dims()
+	step := size / surfaceGrid
+	if step < 1 {
+		step = 1
+	}
+	max := mat.Max(K)
+	// distance between two sampled points and height of the highest point on screen
+	cell := float32(surfaceSize) / float32(size/step+1) / 1.8
+	top := float32(surfaceSize) / 3
+	project := func(i, j int) fyne.Position {
+		// x goes right-down, y goes left-down, heights go up
+		a := float32(i / step)
+		b := float32(j / step)
+		height := float32(K.At(i, j)/max) * top
+		return fyne.NewPos(surfaceSize/2+(a-b)*cell*0.866, top+20+(a+b)*cell*0.5-height)
+	}
+	shade := func(i, j int) color.Color {
+		v := uint8(64 + 191*utils.Clip(K.At(i, j)/max, 0, 1))
+		return color.RGBA{v, v, 0xff, 0xff}
+	}
+	var objects []fyne.CanvasObject
+	// back to front so the closest lines are drawn last
+	for i := 0; i < size; i += step {
+		for j := 0; j < size; j += step {
+			p := project(i, j)
+			for _, next := range [][2]int{{i + step, j}, {i, j + step}} {
+				if next[0] >= size || next[1] >= size {
+					continue
+				}
+				line := canvas.NewLine(shade(i, j))
+				line.Position1 = p
+				line.Position2 = project(next[0], next[1])
+				line.StrokeWidth = 1
+				objects = append(objects, line)
+			}
+			dot := canvas.NewCircle(shade(i, j))
+			dot.Resize(fyne.NewSize(3, 3))
+			dot.Move(p.Subtract(fyne.NewPos(1.5, 1.5)))
+			objects = append(objects, dot)
+		}
+	}
+	return objects
+}
+
+func toggleSurfaceWindow() {
+	// open the kernel surface window, or close it if already open
+	if surfaceWindow != nil {
+		surfaceWindow.Close()
+		return
+	}
+	var objects []fyne.CanvasObject
+	setup.ReadState(func(c *utils.Config) {
+		objects = kernelSurface(c.Kernel)
+	})
+	w := initWindow("Lenia Kernel Surface", surfaceSize, surfaceSize)
+	background := canvas.NewRectangle(color.Black)
+	background.Resize(fyne.NewSize(surfaceSize, surfaceSize))
+	w.SetContent(container.NewWithoutLayout(append([]fyne.CanvasObject{background}, objects...)...))
+	w.SetOnClosed(func() {
+		surfaceWindow = nil
+	})
+	surfaceWindow = w
+	w.Show()
+}
+
+func newRegionSelector() *regionSelector {
+	// transparent layer over the state catching the mouse
+	outline := canvas.NewRectangle(color.Transparent)
+	outline.StrokeColor = color.RGBA{0, 0xff, 0xff, 0xff}
+	outline.StrokeWidth = 1
+	outline.Hide()
+	s := &regionSelector{outline: outline}
+	s.ExtendBaseWidget(s)
+	return s
+}
+
+func (s *regionSelector) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(container.NewWithoutLayout(s.outline))
+}
+
+func (s *regionSelector) MouseDown(e *desktop.MouseEvent) {
+	// ctrl+click starts a new selection
+	if e.Modifier&fyne.KeyModifierControl == 0 {
+		return
+	}
+	s.selecting = true
+	s.start, s.end = e.Position, e.Position
+	s.updateOutline()
+	s.outline.Show()
+}
+
+func (s *regionSelector) MouseUp(*desktop.MouseEvent) {}
+
+func (s *regionSelector) Dragged(e *fyne.DragEvent) {
+	if s.selecting {
+		s.end = e.Position
+		s.updateOutline()
+	}
+}
+
+func (s *regionSelector) DragEnd() {
+	s.selecting = false
+}
+
+func (s *regionSelector) MouseIn(*desktop.MouseEvent) {}
+
+func (s *regionSelector) MouseMoved(e *desktop.MouseEvent) {
+	s.mouse = e.Position
+}
+
+func (s *regionSelector) MouseOut() {}
+
+func (s *regionSelector) updateOutline() {
+	// draw the selection rectangle whatever the drag direction
+	topLeft := fyne.NewPos(float32(math.Min(float64(s.start.X), float64(s.end.X))), float32(math.Min(float64(s.start.Y), float64(s.end.Y))))
+	s.outline.Move(topLeft)
+	s.outline.Resize(fyne.NewSize(float32(math.Abs(float64(s.end.X-s.start.X))), float32(math.Abs(float64(s.end.Y-s.start.Y)))))
+	s.outline.Refresh()
+}
+
+func (s *regionSelector) toCell(p fyne.Position) (int, int) {
+	// state cell under a position, the raster being drawn one pixel per cell
+	scale := stateWindow.Canvas().Scale()
+	return int(p.X * scale), int(p.Y * scale)
+}
+
+func (s *regionSelector) copy() {
+	// keep the selected region of the state in the clipboard
+	if !s.outline.Visible() {
+		return
+	}
+	x1, y1 := s.toCell(s.start)
+	x2, y2 := s.toCell(s.end)
+	x, y := int(math.Min(float64(x1), float64(x2))), int(math.Min(float64(y1), float64(y2)))
+	w, h := int(math.Abs(float64(x2-x1))), int(math.Abs(float64(y2-y1)))
+	if w == 0 || h == 0 {
+		return
+	}
+	setup.ReadState(func(c *utils.Config) {
+		clipboard = utils.CopyRegion(c, x, y, w, h)
+	})
+	s.outline.Hide()
+	slog.Info("region copied", "x", x, "y", y, "width", w, "height", h)
+}
+
+func (s *regionSelector) paste(raster *canvas.Raster) {
+	// write the clipboard with its corner at the mouse position
+	if clipboard == nil {
+		return
+	}
+	x, y := s.toCell(s.mouse)
+	editState(raster, func(c *utils.Config) {
+		utils.PasteRegion(c, clipboard, x, y)
+	})
+}
+
+func toggleSplitWindow() {
+	// open the split colormap view, or close it if already open
+	if splitWindow != nil {
+		splitWindow.Close()
+		return
+	}
+	view := utils.NewSplitColormapView(setup)
+	w := simulationApp.NewWindow("Lenia Colormaps")
+	w.SetContent(view.Container)
+	w.Resize(fyne.NewSize(2*(width-getMargin(width)), height-getMargin(height)))
+	// refreshed at the same rate as the main simulation until closed
+	var dt float64
+	setup.ReadState(func(c *utils.Config) {
+		dt = c.Dt
+	})
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Millisecond * time.Duration(1000*dt))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if running.Load() {
+					view.Refresh()
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	w.SetOnClosed(func() {
+		close(stop)
+		splitWindow = nil
+	})
+	splitWindow = w
+	w.Show()
+}
+
+func openMeanMapWindow() {
+	// average the state over the next steps of a copy of the simulation, then display it
+	var c utils.Config
+	setup.ReadState(func(current *utils.Config) {
+		c = current.Clone()
+	})
+	slog.Info("computing the spatial mean map", "steps", meanMapSteps)
+	go func() {
+		mean := utils.SpatialMeanMap(&c, meanMapSteps)
+		// colors are scaled between the min and max of the map
+		min, max := mat.Min(mean), mat.Max(mean)
+		raster := canvas.NewRaster(func(w, h int) image.Image {
+			img := image.NewRGBA(image.Rect(0, 0, w, h))
+			rows, cols := mean.Dims()
+			for i := 0; i < w && i < rows; i++ {
+				for j := 0; j < h && j < cols; j++ {
+					v := 0.
+					if max > min {
+						v = (mean.At(i, j) - min) / (max - min)
+					}
+					img.Set(i, j, colormap.GetColor(v))
+				}
+			}
+			return img
+		})
+		w := initWindow(fmt.Sprintf("Lenia Mean Map (%d steps)", meanMapSteps), width-getMargin(width), height-getMargin(height))
+		w.SetContent(raster)
+		w.Show()
+	}()
+}
+
+func openPersistenceWindow() {
+	// scatter plot of the persistence pairs of the current state: death level along x and birth along y
+	// points far above the diagonal are lasting blobs, the ones close to it are small bumps
+	var pairs []utils.PersistencePair
+	setup.ReadState(func(c *utils.Config) {
+		pairs = utils.PersistenceDiagram(c, persistenceThreshold)
+	})
+	raster := canvas.NewRaster(func(w, h int) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+		// levels from 0 to 1 with y going up
+		for k := 0; k < w && k < h; k++ {
+			img.Set(k, h-1-k, color.Gray{0x80})
+		}
+		for _, p := range pairs {
+			x, y := int(p.Death*float64(w-1)), h-1-int(p.Birth*float64(h-1))
+			draw.Draw(img, image.Rect(x-2, y-2, x+3, y+3), image.NewUniform(color.RGBA{0xff, 0x40, 0x40, 0xff}), image.Point{}, draw.Src)
+		}
+		return img
+	})
+	w := initWindow(fmt.Sprintf("Lenia Persistence Diagram (%d features)", len(pairs)), persistenceSize, persistenceSize)
 	w.SetContent(raster)
+	w.Show()
+}
+
+func newExplorerCell(onTapped func()) *explorerCell {
+	// create a gray cell until its result arrives
+	rect := canvas.NewRectangle(color.Gray{0x40})
+	rect.SetMinSize(fyne.NewSize(explorerCellSize, explorerCellSize))
+	cell := &explorerCell{rect: rect, onTapped: onTapped}
+	cell.ExtendBaseWidget(cell)
+	return cell
+}
+
+func (e *explorerCell) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(e.rect)
+}
+
+func (e *explorerCell) Tapped(*fyne.PointEvent) {
+	e.onTapped()
+}
+
+func loadParameters(mu, sigma float64) {
+	// set Mu and Sigma of the main simulation, sliders included
+	Mu.Set(mu)
+	Sigma.Set(sigma)
+	slog.Info("parameters loaded", "mu", mu, "sigma", sigma)
+}
+
+func explorerWindow() fyne.Window {
+	// build a heatmap of the entropy for a grid of (Mu, Sigma), filled as the runs end
+	// clicking on a cell loads its parameters in the main simulation
+	var base utils.Config
+	var err error
+	setup.ReadState(func(c *utils.Config) {
+		// R is scaled with the world so that patterns keep their relative size
+		r := math.Max(2, math.Round(c.R*explorerSize/width))
+		base, err = utils.NewConfig(explorerSize, explorerSize, r, c.T, c.Mu, c.Sigma, c.Beta)
+	})
+	if err != nil {
+		dialog.ShowError(err, stateWindow)
+		return nil
+	}
+	values := make([]float64, explorerGrid*explorerGrid)
+	done := make([]bool, explorerGrid*explorerGrid)
+	cells := make([]*explorerCell, explorerGrid*explorerGrid)
+	grid := container.NewGridWithColumns(explorerGrid)
+	// Mu goes right and Sigma goes up
+	for row := 0; row < explorerGrid; row++ {
+		j := explorerGrid - 1 - row
+		for i := 0; i < explorerGrid; i++ {
+			mu := utils.GridValue(explorerMu, i, explorerGrid)
+			sigma := utils.GridValue(explorerSigma, j, explorerGrid)
+			cells[i*explorerGrid+j] = newExplorerCell(func() {
+				loadParameters(mu, sigma)
+			})
+			grid.Add(cells[i*explorerGrid+j])
+		}
+	}
+	status := widget.NewLabel(fmt.Sprintf("Mu %.3g to %.3g (right), Sigma %.3g to %.3g (up)",
+		explorerMu[0], explorerMu[1], explorerSigma[0], explorerSigma[1]))
+	w := simulationApp.NewWindow("Parameter Explorer")
+	w.SetContent(container.NewBorder(nil, status, nil, nil, grid))
+
+	results := make(chan utils.PhaseCell)
+	stop := make(chan struct{})
+	w.SetOnClosed(func() {
+		close(stop)
+	})
+	go utils.PhasePortraitAsync(&base, explorerMu, explorerSigma, explorerGrid, explorerSteps, utils.Entropy, results, stop)
+	go func() {
+		for result := range results {
+			k := result.I*explorerGrid + result.J
+			values[k] = result.Value
+			done[k] = true
+			// colors are scaled between the min and max known so far
+			min, max := math.Inf(1), math.Inf(-1)
+			for k := range values {
+				if done[k] {
+					min = math.Min(min, values[k])
+					max = math.Max(max, values[k])
+				}
+			}
+			for k, cell := range cells {
+				if !done[k] {
+					continue
+				}
+				v := 0.
+				if max > min {
+					v = (values[k] - min) / (max - min)
+				}
+				cell.rect.FillColor = colormap.GetColor(v)
+				cell.rect.Refresh()
+			}
+		}
+	}()
+	return w
+}
+
+func SweepDisplay(param string, values []float64, stepsPerValue int) fyne.Window {
+	// strip of the middle column of the state after stepsPerValue steps for each value of a parameter
+	// (m, s, t or r), each run from the same initial state, like a bifurcation diagram
+	// the columns are added on the right as the runs end and the strip scrolls left
+	set, ok := sweepParams[param]
+	if !ok || len(values) == 0 {
+		slog.Error("invalid sweep", "param", param, "values", len(values))
+		return nil
+	}
+	var base utils.Config
+	var err error
+	setup.ReadState(func(c *utils.Config) {
+		// R is scaled with the world so that patterns keep their relative size
+		r := math.Max(2, math.Round(c.R*explorerSize/width))
+		base, err = utils.NewConfig(explorerSize, explorerSize, r, c.T, c.Mu, c.Sigma, c.Beta)
+	})
+	if err != nil {
+		dialog.ShowError(err, stateWindow)
+		return nil
+	}
+	// every value is checked before the first run
+	for _, v := range values {
+		probe := base
+		set(&probe, v)
+		if err := utils.ValidateConfig(&probe); err != nil {
+			dialog.ShowError(err, stateWindow)
+			return nil
+		}
+	}
+	strip := mat.NewDense(explorerSize, sweepColumns, nil)
+	next := 0 // column written next, the oldest one
+	var lock sync.Mutex
+	raster := canvas.NewRaster(func(w, h int) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		lock.Lock()
+		defer lock.Unlock()
+		for x := 0; x < w; x++ {
+			col := (next + x*sweepColumns/w) % sweepColumns
+			for y := 0; y < h; y++ {
+				img.Set(x, y, colormap.GetColor(strip.At(y*explorerSize/h, col)))
+			}
+		}
+		return img
+	})
+	raster.SetMinSize(fyne.NewSize(sweepColumns*sweepScale, explorerSize*sweepScale))
+	status := widget.NewLabel(fmt.Sprintf("%s from %.3g to %.3g, %d steps each", param, values[0], values[len(values)-1], stepsPerValue))
+	w := simulationApp.NewWindow("Parameter Sweep")
+	w.SetContent(container.NewBorder(nil, status, nil, nil, raster))
+	stop := make(chan struct{})
+	w.SetOnClosed(func() {
+		close(stop)
+	})
+	go func() {
+		for k, v := range values {
+			c := base.Clone()
+			set(&c, v)
+			if param == "r" {
+				c.ComputeKernel()
+			}
+			c.SetSeed(base.Seed)
+			c.A.Zero()
+			c.InitState()
+			for s := 0; s < stepsPerValue; s++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				c.Update()
+			}
+			lock.Lock()
+			_, cols := c.A.Dims()
+			strip.SetCol(next, mat.Col(nil, cols/2, c.A))
+			next = (next + 1) % sweepColumns
+			lock.Unlock()
+			raster.Refresh()
+			status.SetText(fmt.Sprintf("%s = %.4g (%d/%d), %d steps each", param, v, k+1, len(values), stepsPerValue))
+		}
+	}()
 	return w
 }
 
+func toggleStackWindow() {
+	// open the stacked worlds window, or close it if already open
+	if stackWindow != nil {
+		stackWindow.Close()
+		return
+	}
+	setup.ReadState(func(c *utils.Config) {
+		stackLock.Lock()
+		stack = utils.NewStack3D(c, stackSlices, stackCoupling)
+		stackLock.Unlock()
+	})
+	winHeight := stackSlices * stackScale
+	w := initWindow("Lenia Stack (xz-plane)", width-getMargin(width), float32(winHeight)-getMargin(winHeight))
+	raster := canvas.NewRaster(displayStack)
+	w.SetContent(raster)
+	stop := make(chan struct{})
+	w.SetOnClosed(func() {
+		close(stop)
+		stackWindow = nil
+	})
+	go animateStack(raster, stop)
+	stackWindow = w
+	w.Show()
+}
+
+func togglePolarWindow() {
+	// open the polar world with the current parameters, or close it if already open
+	// R is scaled to the disk, smaller than the main world
+	if polarWindow != nil {
+		polarWindow.Close()
+		return
+	}
+	setup.ReadState(func(c *utils.Config) {
+		r := math.Max(2, math.Round(c.R*2*polarRings/width))
+		polarLock.Lock()
+		polar = utils.NewPolarConfig(polarRings, polarSectors, r, c.T, c.Mu, c.Sigma, c.Beta)
+		polar.KernelCore = c.KernelCore
+		polar.ComputeKernel()
+		polarLock.Unlock()
+	})
+	size := float32(2 * polarRings * polarScale)
+	w := initWindow("Lenia Polar", size-getMargin(int(size)), size-getMargin(int(size)))
+	raster := canvas.NewRaster(displayPolar)
+	w.SetContent(raster)
+	stop := make(chan struct{})
+	w.SetOnClosed(func() {
+		close(stop)
+		polarWindow = nil
+	})
+	go animatePolar(raster, stop)
+	polarWindow = w
+	w.Show()
+}
+
+func toggleMultiWindow() {
+	// open a world of several species with the current parameters, or close it if already open
+	// each species starts from its own random state
+	if multiWindow != nil {
+		multiWindow.Close()
+		return
+	}
+	setup.ReadState(func(c *utils.Config) {
+		multiLock.Lock()
+		multi = utils.NewMultiConfig(c, multiColors)
+		multiLock.Unlock()
+	})
+	w := initWindow("Lenia Species", width-getMargin(width), height-getMargin(height))
+	raster := canvas.NewRaster(displayMulti)
+	w.SetContent(raster)
+	stop := make(chan struct{})
+	w.SetOnClosed(func() {
+		close(stop)
+		multiWindow = nil
+	})
+	go animateMulti(raster, stop)
+	multiWindow = w
+	w.Show()
+}
+
+func toggleComplexWindow() {
+	// open a world of complex cells with the current parameters, or close it if already open
+	// it starts from the usual initial state as magnitude with random phases
+	if complexWindow != nil {
+		complexWindow.Close()
+		return
+	}
+	var err error
+	setup.ReadState(func(c *utils.Config) {
+		h, w := c.A.Dims()
+		complexLock.Lock()
+		defer complexLock.Unlock()
+		if complexWorld, err = utils.NewComplexConfig(h, w, c.R, c.T, c.Mu, c.Sigma, c.Beta); err == nil && complexWorld.KernelCore != c.KernelCore {
+			complexWorld.KernelCore = c.KernelCore
+			complexWorld.ComputeKernel()
+		}
+	})
+	if err != nil {
+		dialog.ShowError(err, stateWindow)
+		return
+	}
+	w := initWindow("Lenia Complex", width-getMargin(width), height-getMargin(height))
+	raster := canvas.NewRaster(displayComplex)
+	w.SetContent(raster)
+	stop := make(chan struct{})
+	w.SetOnClosed(func() {
+		close(stop)
+		complexWindow = nil
+	})
+	go animateComplex(raster, stop)
+	complexWindow = w
+	w.Show()
+}
+
+func subscribeLogging() {
+	// log the simulation events worth noticing, and every step at the debug level
+	events.Subscribe(utils.EventStep, func(e utils.Event) {
+		if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+			c := e.Config
+			slog.Debug("step", "step", c.Step, "mean", utils.MeanState(c), "energy", c.Energy, "complexity", utils.MDLComplexity(c), "kernel_support_radius", c.KernelSupportRadius, "elapsed", e.Elapsed)
+		}
+	})
+	events.Subscribe(utils.EventParamChange, func(e utils.Event) {
+		slog.Info("parameter changed", "name", e.Name, "value", e.Value)
+	})
+	events.Subscribe(utils.EventReset, func(e utils.Event) {
+		slog.Info("state restarted")
+	})
+	events.Subscribe(utils.EventSave, func(e utils.Event) {
+		slog.Info("checkpoint saved", "path", e.Path, "step", e.Step)
+	})
+	for _, eventType := range []string{utils.EventSteady, utils.EventDiverge} {
+		events.Subscribe(eventType, func(e utils.Event) {
+			slog.Info("state changed", "kind", e.Type, "step", e.Step, "energy", e.Value)
+		})
+	}
+	events.Subscribe(utils.EventOscillation, func(e utils.Event) {
+		slog.Info("oscillation period changed", "step", e.Step, "period", e.Value)
+	})
+}
+
+func followParamChanges() {
+	// move the sliders and the beta field to the parameters changed elsewhere
+	// (the ring editor and the /params endpoint)
+	sliders := map[string]*utils.Parameter{"R": &R, "T": &T, "Mu": &Mu, "Sigma": &Sigma}
+	events.Subscribe(utils.EventParamChange, func(e utils.Event) {
+		if p, ok := sliders[e.Name]; ok && p.GetValue() != e.Value {
+			p.Bind.Set(e.Value)
+		}
+	})
+	events.Subscribe(utils.EventParams, func(e utils.Event) {
+		if R.GetValue() != e.Value {
+			R.Bind.Set(e.Value)
+		}
+		BetaTextField.SetText(utils.BetaToFlag(e.Beta))
+	})
+}
+
+func pauseAtBreakpoints() {
+	// stop the simulation when a breakpoint is reached
+	events.Subscribe(utils.EventBreakpoint, func(e utils.Event) {
+		slog.Info("paused at breakpoint", "step", e.Step)
+		setRunning(false)
+		pauseLabel.Text = fmt.Sprintf("paused at step %d", e.Step)
+		pauseLabel.Refresh()
+	})
+}
+
+func trackStats() {
+	// time each step for the metrics endpoint, and keep the metrics series when the charts are compiled in
+	events.Subscribe(utils.EventStep, func(e utils.Event) {
+		stats.Record(e.Elapsed)
+		if api.PlotAvailable {
+			stats.RecordMetrics(e.Step, utils.MeasureRun(e.Config, componentThreshold))
+		}
+	})
+}
+
+func watchCreatures() {
+	// snapshot the new creature types, the label counts them
+	events.Subscribe(utils.EventStep, func(e utils.Event) {
+		found, err := catalog.Observe(e.Config, componentThreshold)
+		if err != nil {
+			slog.Warn("creature snapshot failed", "err", err)
+		} else if found {
+			catalogLabel.SetText(fmt.Sprintf("creature types: %d", len(catalog.Hashes)))
+		}
+	})
+}
+
+func recordStats(db *utils.StatsDB, runID string) {
+	// store the metrics of every step under the run id
+	slog.Info("recording stats", "run", runID)
+	events.Subscribe(utils.EventStep, func(e utils.Event) {
+		if err := db.Record(runID, e.Step, e.Config, utils.MeasureRun(e.Config, componentThreshold)); err != nil {
+			slog.Warn("stats not recorded", "step", e.Step, "err", err)
+		}
+	})
+}
+
+func watchSteadyState(logger *utils.CSVLogger) {
+	// publish when the simulation becomes steady or starts moving again
+	detector := utils.NewSteadyStateDetector(50, 20, 1e-10, 1e-8)
+	events.Subscribe(utils.EventStep, func(e utils.Event) {
+		if event, ok := detector.Observe(e.Config); ok {
+			events.Publish(utils.Event{Type: event.Kind, Step: event.Step, Value: event.Energy})
+		}
+	})
+	if logger == nil {
+		return
+	}
+	for _, eventType := range []string{utils.EventSteady, utils.EventDiverge} {
+		events.Subscribe(eventType, func(e utils.Event) {
+			logger.Log(strconv.Itoa(e.Step), e.Type, strconv.FormatFloat(e.Value, 'g', -1, 64))
+		})
+	}
+}
+
+func watchOscillation() {
+	// publish the period of the mean of the state when it changes, checked every 25 steps
+	// over the last 400 steps, for periods up to 100 steps
+	detector := utils.NewOscillationDetector(400, 100, 25)
+	events.Subscribe(utils.EventStep, func(e utils.Event) {
+		if period, ok := detector.Observe(e.Config); ok {
+			events.Publish(utils.Event{Type: utils.EventOscillation, Step: e.Step, Value: float64(period)})
+		}
+	})
+	events.Subscribe(utils.EventOscillation, func(e utils.Event) {
+		oscillationPeriod.Store(int64(e.Value))
+	})
+}
+
 func listenKeys(w fyne.Window) {
 	// listen for key press
 	w.Canvas().SetOnTypedKey(func(k *fyne.KeyEvent) {
 		switch k.Name {
 		// screenshot
 		case "S":
-			fmt.Println("Image saved")
+			var err error
 			if kFlag {
-				winWidth := int(2*setup.R + 1)
-				utils.SaveImage(w, winWidth, winWidth)
+				var winWidth int
+				setup.ReadState(func(c *utils.Config) {
+					winWidth = int(2*c.R + 1)
+				})
+				err = utils.SaveImage(w, winWidth, winWidth)
 			} else {
-				utils.SaveImage(w, width, height)
+				err = utils.SaveImage(w, width, height)
 			}
-		// close
+			if err != nil {
+				slog.Error("screenshot failed", "err", err)
+			} else {
+				slog.Info("image saved")
+			}
+		// annotated export
+		case "E":
+			if stateWindow != nil {
+				path := fmt.Sprintf("images/%s-annotated.png", time.Now().Format("2006-01-02T15:04:05"))
+				var err error
+				setup.ReadState(func(c *utils.Config) {
+					err = utils.ExportAnnotated(c, colormap, path)
+				})
+				if err != nil {
+					slog.Error("export failed", "err", err)
+				} else {
+					slog.Info("image exported", "path", path)
+				}
+			}
+		// invert
+		case "I":
+			if stateRaster != nil {
+				editState(stateRaster, (*utils.Config).Invert)
+			}
+		// frames recording
+		case "R":
+			if stateWindow != nil {
+				toggleRecording()
+			}
+		// history overlay
+		case "H":
+			if stateRaster != nil {
+				editState(stateRaster, func(c *utils.Config) {
+					history.Enabled = !history.Enabled
+					history.Clear()
+					history.Push(c.A)
+				})
+			}
+		// stacked 3D view
+		case "3":
+			if stateWindow != nil {
+				toggleStackWindow()
+			}
+		// polar world
+		case "O":
+			if stateWindow != nil {
+				togglePolarWindow()
+			}
+		// multi-species world
+		case "N":
+			if stateWindow != nil {
+				toggleMultiWindow()
+			}
+		// complex world
+		case "Z":
+			if stateWindow != nil {
+				toggleComplexWindow()
+			}
+		// kernel 3D surface
+		case "K":
+			toggleSurfaceWindow()
+		// split colormap view
+		case "V":
+			if stateWindow != nil {
+				toggleSplitWindow()
+			}
+		// metric charts
+		case "G":
+			if stateWindow != nil {
+				path := fmt.Sprintf("images/%s-metrics.pdf", time.Now().Format("2006-01-02T15-04-05"))
+				setup.ReadState(func(c *utils.Config) {
+					h, w := c.A.Dims()
+					stats.SetParams(utils.Params{Width: w, Height: h, R: c.R, T: c.T, Mu: c.Mu, Sigma: c.Sigma, Beta: c.Beta})
+				})
+				if err := api.PlotTimeSeries(&stats, path); err != nil {
+					slog.Error("charts not saved", "err", err)
+				} else {
+					slog.Info("charts saved", "path", path)
+				}
+			}
+		// spectrogram panel
+		case "P":
+			if stateWindow != nil {
+				toggleSpectrogram()
+			}
+		// HDF5 world
+		case "W":
+			if stateWindow != nil {
+				path := fmt.Sprintf("images/%s.h5", time.Now().Format("2006-01-02T15-04-05"))
+				var err error
+				setup.ReadState(func(c *utils.Config) {
+					err = utils.SaveHDF5(path, c)
+				})
+				if err != nil {
+					slog.Error("world not saved", "err", err)
+				} else {
+					slog.Info("world saved", "path", path)
+				}
+			}
+		// persistence diagram
+		case "D":
+			if stateWindow != nil {
+				openPersistenceWindow()
+			}
+		// spatial mean map
+		case "M":
+			if stateWindow != nil {
+				openMeanMapWindow()
+			}
+		// kernel spectrum
+		case "F":
+			if kernelRaster != nil {
+				editState(kernelRaster, func(c *utils.Config) {
+					showSpectrum = !showSpectrum
+					rows, _ := c.A.Dims()
+					kernelSpectrum = utils.CenteredLogMagnitude(utils.FullSpectrum(c.KFFT, rows))
+				})
+			}
+		// boundary overlay
+		case "B":
+			if stateRaster != nil {
+				editState(stateRaster, func(*utils.Config) {
+					showBoundary = !showBoundary
+				})
+			}
+		// random parameters
+		case fyne.KeySpace:
+			if stateRaster != nil {
+				var mu, sigma float64
+				var beta []float64
+				var err error
+				editState(stateRaster, func(c *utils.Config) {
+					err = utils.RandomizeParams(c, paramRand, randomMu, randomSigma, randomBeta, randomBetaLength)
+					mu, sigma, beta = c.Mu, c.Sigma, c.Beta
+				})
+				if err != nil {
+					slog.Warn("parameters not randomized", "err", err)
+					return
+				}
+				slog.Info("random parameters", "mu", mu, "sigma", sigma, "beta", beta)
+				// the controls follow, the setup is already up to date
+				Mu.Bind.Set(mu)
+				Sigma.Bind.Set(sigma)
+				BetaTextField.SetText(utils.BetaToFlag(beta))
+				events.Publish(utils.Event{Type: utils.EventReset})
+			}
+		// step back to the previous state
+		case fyne.KeyLeft:
+			if stateRaster != nil {
+				var offsetX, offsetY int
+				editState(stateRaster, func(c *utils.Config) {
+					if !c.StepBack() {
+						slog.Info("no previous state kept")
+					}
+					offsetX, offsetY = c.OffsetX, c.OffsetY
+				})
+				offsetXSlider.SetValue(float64(offsetX))
+				offsetYSlider.SetValue(float64(offsetY))
+			}
+		// center the patterns
 		case "C":
+			if stateRaster != nil {
+				editState(stateRaster, func(c *utils.Config) {
+					utils.CenterPattern(c, componentThreshold)
+				})
+			}
+		// clear the world, after confirmation
+		case "X":
+			if stateRaster != nil {
+				dialog.ShowConfirm("Clear the world", "Set every cell to 0? The parameters are kept.", func(ok bool) {
+					if !ok {
+						return
+					}
+					editState(stateRaster, func(c *utils.Config) {
+						c.Reset()
+					})
+					events.Publish(utils.Event{Type: utils.EventReset})
+				}, w)
+			}
+		// close
+		case "Q":
 			w.Close()
 		}
 	})
 }
 
+func runBatch(args []string) {
+	// run headless simulations and write their metrics as JSON
+	batch := flag.NewFlagSet("batch", flag.ExitOnError)
+	configFlag := batch.String("config", "", "TOML file with the parameters (width, height, r, t, mu, sigma, beta)")
+	stepsFlag := batch.Int("steps", 500, "number of steps of each run")
+	metricFlag := batch.String("metric", "mean", "comma separated metrics: mean, entropy, components")
+	outputFlag := batch.String("output", "results.json", "JSON file receiving the metrics of each step")
+	jobsFlag := batch.Int("jobs", 1, "number of runs computed in parallel")
+	seedsFlag := batch.Int("seeds", 1, "number of runs, each with its own seed")
+	batch.Parse(args)
+
+	params := utils.DefaultParams()
+	if *configFlag != "" {
+		var err error
+		if params, err = utils.LoadParams(*configFlag); err != nil {
+			slog.Error("cannot read the config", "err", err)
+			os.Exit(1)
+		}
+	}
+	start := time.Now()
+	// run k uses the seed k
+	records, err := utils.RunBatch(params, *stepsFlag, strings.Split(*metricFlag, ","), 0, *seedsFlag, *jobsFlag)
+	if err != nil {
+		slog.Error("batch failed", "err", err)
+		os.Exit(1)
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err == nil {
+		err = os.WriteFile(*outputFlag, data, 0644)
+	}
+	if err != nil {
+		slog.Error("cannot write the results", "err", err)
+		os.Exit(1)
+	}
+	slog.Info("batch done", "runs", *seedsFlag, "output", *outputFlag, "elapsed", time.Since(start))
+}
+
+func runCompare(args []string) {
+	// run presets side by side and print their final metrics as a markdown table
+	compare := flag.NewFlagSet("compare", flag.ExitOnError)
+	presetsFlag := compare.String("presets", "presets.toml", "TOML file with [[preset]] tables (name, seed, width, height, r, t, mu, sigma, beta)")
+	stepsFlag := compare.Int("steps", 500, "number of steps of each run")
+	metricFlag := compare.String("metric", "mean,entropy,components", "comma separated metrics: mean, entropy, components")
+	trialsFlag := compare.Int("trials", 0, "also run each preset from this number of random initial states and show the fraction going extinct")
+	compare.Parse(args)
+
+	presets, err := utils.LoadPresets(*presetsFlag)
+	if err != nil {
+		slog.Error("cannot read the presets", "err", err)
+		os.Exit(1)
+	}
+	metrics := strings.Split(*metricFlag, ",")
+	for _, name := range metrics {
+		if _, ok := utils.Metrics[name]; !ok {
+			slog.Error("unknown metric", "metric", name)
+			os.Exit(1)
+		}
+	}
+	results, err := utils.ComparePresets(presets, *stepsFlag, metrics)
+	if err != nil {
+		slog.Error("presets not compared", "err", err)
+		os.Exit(1)
+	}
+	if *trialsFlag > 0 {
+		for k, p := range presets {
+			// the presets are validated by ComparePresets
+			c, _ := p.NewConfig(p.Seed)
+			results[k]["extinction"] = utils.EstimateHeatDeathProbability(c, *trialsFlag, *stepsFlag)
+		}
+		metrics = append(metrics, "extinction")
+	}
+	fmt.Print(utils.PresetsTable(presets, metrics, results))
+}
+
+func runCluster(args []string) {
+	// sweep Mu and Sigma, group the runs by their final metrics and print a preset of each group
+	cluster := flag.NewFlagSet("cluster", flag.ExitOnError)
+	configFlag := cluster.String("config", "", "TOML file with the other parameters (width, height, r, t, beta)")
+	stepsFlag := cluster.Int("steps", 200, "number of steps of each run")
+	gridFlag := cluster.Int("grid", 8, "number of Mu and of Sigma values, the sweep has grid*grid runs")
+	muFlag := cluster.String("mu", "0.1,0.4", "range of Mu")
+	sigmaFlag := cluster.String("sigma", "0.005,0.05", "range of Sigma")
+	kFlag := cluster.Int("k", 4, "number of clusters")
+	metricFlag := cluster.String("metric", "mean,entropy,components", "comma separated metrics the runs are grouped by: mean, entropy, components, complexity, resonance")
+	seedFlag := cluster.Int64("seed", 0, "seed of the initial state of every run")
+	cluster.Parse(args)
+
+	params := utils.DefaultParams()
+	if *configFlag != "" {
+		var err error
+		if params, err = utils.LoadParams(*configFlag); err != nil {
+			slog.Error("cannot read the config", "err", err)
+			os.Exit(1)
+		}
+	}
+	metrics := strings.Split(*metricFlag, ",")
+	for _, name := range metrics {
+		if _, ok := utils.Metrics[name]; !ok {
+			slog.Error("unknown metric", "metric", name)
+			os.Exit(1)
+		}
+	}
+	muRange, sigmaRange := utils.FlagToBeta(*muFlag), utils.FlagToBeta(*sigmaFlag)
+	if len(muRange) != 2 || len(sigmaRange) != 2 || *gridFlag < 2 {
+		slog.Error("the ranges need two values and the grid at least 2 values")
+		os.Exit(1)
+	}
+	values := func(bounds []float64) []float64 {
+		v := make([]float64, *gridFlag)
+		for k := range v {
+			v[k] = bounds[0] + (bounds[1]-bounds[0])*float64(k)/float64(*gridFlag-1)
+		}
+		return v
+	}
+	start := time.Now()
+	results, err := utils.SweepMuSigma(params, values(muRange), values(sigmaRange), *seedFlag, *stepsFlag, metrics)
+	if err != nil {
+		slog.Error("sweep not run", "err", err)
+		os.Exit(1)
+	}
+	clusters := utils.ClusterPresets(results, *kFlag)
+	slog.Info("sweep done", "runs", len(results), "elapsed", time.Since(start))
+	var presets []utils.Preset
+	for _, c := range clusters {
+		if len(c.Members) == 0 {
+			continue
+		}
+		c.Preset.Seed = *seedFlag
+		presets = append(presets, c.Preset)
+		slog.Info("cluster", "name", c.Preset.Name, "centroid", c.Centroid)
+	}
+	text, err := utils.PresetsTOML(presets)
+	if err != nil {
+		slog.Error("cannot write the presets", "err", err)
+		os.Exit(1)
+	}
+	fmt.Print(text)
+}
+
+func runWalk(args []string) {
+	// random walk in the (Mu, Sigma, Beta) space and print the accepted parameters as presets
+	walk := flag.NewFlagSet("walk", flag.ExitOnError)
+	configFlag := walk.String("config", "", "TOML file with the starting parameters (width, height, r, t, mu, sigma, beta)")
+	stepsFlag := walk.Int("steps", 200, "number of steps of each run")
+	movesFlag := walk.Int("moves", 100, "number of moves of the walk, each one is a run")
+	temperatureFlag := walk.Float64("temperature", 0.01, "temperature of the Metropolis criterion, higher accepts more decreases of the metric")
+	metricFlag := walk.String("metric", "complexity", "metric the walk goes up: mean, entropy, components, complexity, resonance")
+	seedFlag := walk.Int64("seed", 0, "seed of the walk and of the initial state of every run")
+	walk.Parse(args)
+
+	params := utils.DefaultParams()
+	if *configFlag != "" {
+		var err error
+		if params, err = utils.LoadParams(*configFlag); err != nil {
+			slog.Error("cannot read the config", "err", err)
+			os.Exit(1)
+		}
+	}
+	explorer := utils.NewRandomWalkExplorer(params, *stepsFlag, *seedFlag)
+	explorer.Temperature = *temperatureFlag
+	explorer.Metric = *metricFlag
+	start := time.Now()
+	accepted, err := explorer.Walk(*movesFlag)
+	if err != nil {
+		slog.Error("walk failed", "err", err)
+		os.Exit(1)
+	}
+	slog.Info("walk done", "moves", *movesFlag, "accepted", accepted, *metricFlag, explorer.Score, "elapsed", time.Since(start))
+	text, err := utils.PresetsTOML(explorer.Catalog)
+	if err != nil {
+		slog.Error("cannot write the presets", "err", err)
+		os.Exit(1)
+	}
+	fmt.Print(text)
+}
+
 func main() {
+	// headless runs
+	if len(os.Args) > 1 && os.Args[1] == "batch" {
+		runBatch(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		runCompare(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "cluster" {
+		runCluster(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "walk" {
+		runWalk(os.Args[2:])
+		return
+	}
+
+	simulationApp = app.New()
 	var w fyne.Window
 	// parse command arguments
 	var RFlag, TFlag, MuFlag, SigmaFlag float64
-	var BetaFlag string
+	var BetaFlag, boundaryFlag, catalogFlag, clipFlag, coreFlag, gridFlag, eventsFlag, statsDBFlag, metricsAddrFlag, logLevelFlag, initFlag, muMapFlag, maskFlag, breakFlag, loadFlag string
+	var autosaveFlag time.Duration
+	var historyFlag, fftPadFlag, undoFlag int
+	var fastFlag, perceptualFlag, verboseFlag, asymmetricFlag bool
 	flag.BoolVar(&kFlag, "k", false, "display the kernel")
 	flag.Float64Var(&RFlag, "r", 80, "set the kernel radius")
 	flag.Float64Var(&TFlag, "t", 40, "set the timeline")
 	flag.Float64Var(&MuFlag, "m", 0.23, "set the growth center")
 	flag.Float64Var(&SigmaFlag, "s", 0.024, "set the growth width")
 	flag.StringVar(&BetaFlag, "b", "1,0.6,0.3", "set the beta parameter as a string where the values are separated by a comma")
+	flag.DurationVar(&autosaveFlag, "autosave", 0, "save a checkpoint at this interval, optionally followed by the directory (default \"checkpoints\")")
+	flag.StringVar(&gridFlag, "grid", "square", "set the lattice of the kernel: square or hex (cells in axial coordinates, the kernel can not be stretched)")
+	flag.IntVar(&interpFactor, "interp-factor", 1, "write this number of frames per step when recording, blending two steps (smoother videos)")
+	flag.IntVar(&fftPadFlag, "fft-pad", 1, "zero-pad the state to this factor of its size before the FFT, small kernels convolved directly get a zero border (reduces wrap around artifacts)")
+	flag.IntVar(&undoFlag, "undo", 20, "set the number of previous states kept to step back with the left arrow")
+	flag.IntVar(&historyFlag, "history", 5, "set the number of states shown by the history overlay")
+	flag.StringVar(&boundaryFlag, "boundary", "torus", "set the world boundary: torus, wall or reflect")
+	flag.StringVar(&catalogFlag, "catalog", "", "save a snapshot of each new pattern (by perceptual hash, at most one every 100 steps) in this directory")
+	flag.StringVar(&clipFlag, "clip", "hard", "set how the state is kept between 0 and 1: hard or soft")
+	flag.StringVar(&coreFlag, "core", "exp", "set the kernel core function: exp or poly")
+	flag.StringVar(&eventsFlag, "events", "", "log the steady/diverge events to this CSV file")
+	flag.StringVar(&statsDBFlag, "statsdb", "", "store the metrics of each step in this SQLite database (build with -tags sqlite)")
+	flag.BoolVar(&verboseFlag, "v", false, "print the kernel diagnostics")
+	flag.BoolVar(&fastFlag, "fast", false, "approximate the exponential of the growth mapping")
+	flag.BoolVar(&perceptualFlag, "perceptual", false, "interpolate the colormaps in CIELAB instead of RGB")
+	flag.StringVar(&logLevelFlag, "log-level", "info", "set the log level: debug, info, warn or error")
+	flag.StringVar(&initFlag, "init", "rectangles", "set the initial state: rectangles, full, fractal, voronoi or gaussians")
+	flag.StringVar(&metricsAddrFlag, "metrics-addr", "", "serve prometheus metrics at this address (for example :9090)")
+	flag.StringVar(&muMapFlag, "mumap", "", "set a spatial growth center from a grayscale PNG (black is half the growth center, white 1.5 times)")
+	flag.StringVar(&maskFlag, "mask", "", "restrict the world to the white cells of a black and white PNG of its size")
+	flag.BoolVar(&asymmetricFlag, "asymmetric", false, "bias the kernel towards the angle of the \"Kernel bias\" slider, for creatures moving in this direction")
+	flag.StringVar(&breakFlag, "break", "", "pause the simulation at these steps, separated by commas")
+	flag.StringVar(&loadFlag, "load", "", "start from a world saved as HDF5 with w (build with -tags hdf5)")
 	flag.Parse()
 
-	// initialize setup
-	initParameters(RFlag, TFlag, MuFlag, SigmaFlag, utils.FlagToBeta(BetaFlag))
+	// structured logging
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logLevelFlag)); err != nil {
+		slog.Warn("unknown log level, using info", "level", logLevelFlag)
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	// saved world, its parameters replace the flags
+	var loaded *utils.Config
+	if loadFlag != "" {
+		if c, err := utils.LoadHDF5(loadFlag); err != nil {
+			slog.Warn("world not loaded", "err", err)
+		} else if h, w := c.A.Dims(); h != width || w != height {
+			slog.Warn("world not loaded", "err", fmt.Sprintf("it is %dx%d, the window shows %dx%d", h, w, width, height))
+		} else {
+			loaded = &c
+			RFlag, TFlag, MuFlag, SigmaFlag = c.R, c.T, c.Mu, c.Sigma
+			BetaFlag = utils.BetaToFlag(c.Beta)
+		}
+	}
+
+	// initialize setup, every invalid flag is reported before building the world
+	if err := initParameters(RFlag, TFlag, MuFlag, SigmaFlag, utils.FlagToBeta(BetaFlag)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	running.Store(true)
+	history = utils.NewHistoryOverlay(historyFlag)
+	if init, ok := initStates[initFlag]; ok {
+		initState = init
+	} else {
+		slog.Warn("unknown initial state, using rectangles", "init", initFlag)
+	}
+	setup.WriteState(func(c *utils.Config) {
+		c.A = mat.NewDense(width, height, nil)
+		initState(c)
+		c.Events = events
+		c.FastMath = fastFlag
+		c.PerceptualColormap = perceptualFlag
+		c.FFTPadFactor = fftPadFlag
+		c.HistoryDepth = undoFlag
+		if loaded != nil {
+			c.A = loaded.A
+			c.Step = loaded.Step
+			c.SetHistory(loaded.History())
+		}
+		if muMapFlag != "" {
+			if err := utils.LoadMuMapFromImage(muMapFlag, c, c.Mu/2, 3*c.Mu/2); err != nil {
+				slog.Warn("mu map not loaded", "err", err)
+			}
+		}
+		if breakFlag != "" {
+			if breakpoints, err := utils.FlagToBreakpoints(breakFlag); err != nil {
+				slog.Warn("breakpoints ignored", "err", err)
+			} else {
+				c.Breakpoints = breakpoints
+			}
+		}
+		if maskFlag != "" {
+			if err := utils.LoadMaskFromImage(maskFlag, c); err != nil {
+				slog.Warn("mask not loaded", "err", err)
+			}
+		}
+		if boundary, ok := utils.FlagToBoundary(boundaryFlag); ok {
+			c.Boundary = boundary
+		} else {
+			slog.Warn("unknown boundary, using torus", "boundary", boundaryFlag)
+		}
+		if core, ok := utils.FlagToKernelCore(coreFlag); ok {
+			c.KernelCore = core
+		} else {
+			slog.Warn("unknown kernel core, using exp", "core", coreFlag)
+		}
+		c.UseAsymmetricKernel = asymmetricFlag
+		if grid, ok := utils.FlagToGridType(gridFlag); ok {
+			c.GridType = grid
+		} else {
+			slog.Warn("unknown grid, using square", "grid", gridFlag)
+		}
+		c.ComputeKernel()
+		if clipMode, ok := utils.FlagToClipMode(clipFlag); ok {
+			c.ClipMode = clipMode
+		} else {
+			slog.Warn("unknown clip mode, using hard", "clip", clipFlag)
+		}
+	})
+
+	if verboseFlag {
+		setup.ReadState(func(c *utils.Config) {
+			d := utils.DiagnoseKernel(c)
+			fmt.Printf("kernel\n%s\ngrowth resonance: %.4g\n", d, utils.GrowthResonance(c))
+		})
+	}
+
+	// observers of the simulation events
+	subscribeLogging()
+	pauseAtBreakpoints()
+	followParamChanges()
+	trackStats()
+	recordFrames()
+	watchSpectrum()
+	// detect steady states
+	var logger *utils.CSVLogger
+	if eventsFlag != "" {
+		var err error
+		logger, err = utils.NewCSVLogger(eventsFlag, []string{"step", "event", "energy"})
+		if err != nil {
+			slog.Warn("events logging disabled", "err", err)
+		} else {
+			defer logger.Close()
+		}
+	}
+	watchSteadyState(logger)
+	watchOscillation()
+
+	// metrics of each step kept across runs
+	if statsDBFlag != "" {
+		var db utils.StatsDB
+		if err := db.Open(statsDBFlag); err != nil {
+			slog.Warn("stats database disabled", "err", err)
+		} else {
+			defer db.Close()
+			recordStats(&db, utils.NewRunID())
+		}
+	}
+
+	// creature catalog
+	if catalogFlag != "" {
+		var err error
+		if catalog, err = utils.NewCreatureCatalog(catalogFlag); err != nil {
+			slog.Warn("creature catalog disabled", "err", err)
+		} else {
+			watchCreatures()
+		}
+	}
+
+	// metrics endpoint
+	if metricsAddrFlag != "" {
+		api.ComponentThreshold = componentThreshold
+		go func() {
+			if err := api.ServeMetrics(metricsAddrFlag, setup, &stats); err != nil {
+				slog.Error("metrics endpoint stopped", "err", err)
+			}
+		}()
+	}
+
+	// periodically save checkpoints
+	if autosaveFlag > 0 {
+		dir := "checkpoints"
+		if flag.NArg() > 0 {
+			dir = flag.Arg(0)
+		}
+		cancel := utils.AutoSave(setup, dir, autosaveFlag)
+		defer cancel()
+	}
 
 	// define what to display
 	if kFlag {
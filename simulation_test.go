@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path/filepath"
+	"rd/utils"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestReproducibility(t *testing.T) {
+	// 100 steps, a checkpoint round trip and 100 more steps give exactly the state of 200 steps
+	p := utils.Params{Width: 128, Height: 128, R: 13, T: 10, Mu: 0.15, Sigma: 0.015, Beta: []float64{1}}
+	uninterrupted, err := p.NewConfig(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interrupted := uninterrupted.Clone()
+	for step := 0; step < 200; step++ {
+		uninterrupted.Update()
+	}
+	for step := 0; step < 100; step++ {
+		interrupted.Update()
+	}
+	path := filepath.Join(t.TempDir(), "checkpoint.gob")
+	if err := utils.SaveCheckpoint(&interrupted, path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := utils.LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for step := 0; step < 100; step++ {
+		loaded.Update()
+	}
+	if !loaded.Equal(uninterrupted) {
+		t.Fatal("the run resumed from a checkpoint differs from the uninterrupted run")
+	}
+}
+
+func TestCheckpointSeedZero(t *testing.T) {
+	// a checkpoint of seed 0 restarts its random source from 0: a new initial state drawn
+	// after loading is the one of a new run of seed 0
+	p := utils.Params{Width: 128, Height: 128, R: 13, T: 10, Mu: 0.15, Sigma: 0.015, Beta: []float64{1}}
+	c, err := p.NewConfig(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh := c.Clone()
+	for step := 0; step < 10; step++ {
+		c.Update()
+	}
+	path := filepath.Join(t.TempDir(), "checkpoint.gob")
+	if err := utils.SaveCheckpoint(&c, path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := utils.LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Seed != 0 {
+		t.Fatalf("seed %d after loading, want 0", loaded.Seed)
+	}
+	loaded.Reset()
+	loaded.InitState()
+	if !mat.Equal(loaded.A, fresh.A) {
+		t.Fatal("the state drawn after loading differs from the initial state of seed 0")
+	}
+}
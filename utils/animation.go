@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"math"
+	"os"
+)
+
+func growthCurveFrame(mu, sigma float64, width, height int, palette color.Palette) *image.Paletted {
+	// draw the growth mapping G(u) for u in [0, 1], G going from -1 (bottom) to 1 (top)
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	// the curve and the axes are kept in the frame
+	toY := func(g float64) int {
+		return int(math.Round((1 - Clip(g, -1, 1)) / 2 * float64(height-1)))
+	}
+	// axes: G = 0 and u = mu
+	for x := 0; x < width; x++ {
+		img.SetColorIndex(x, toY(0), 2)
+	}
+	muX := int(Clip(mu, 0, 1) * float64(width-1))
+	for y := 0; y < height; y++ {
+		img.SetColorIndex(muX, y, 2)
+	}
+	// curve, joining each point to the previous one
+	s := 2 * sigma * sigma
+	previous := -1
+	for x := 0; x < width; x++ {
+		u := float64(x) / float64(width-1)
+		y := toY(2*math.Exp(-math.Pow(u-mu, 2)/s) - 1)
+		if previous < 0 {
+			previous = y
+		}
+		from, to := previous, y
+		if from > to {
+			from, to = to, from
+		}
+		for k := from; k <= to; k++ {
+			img.SetColorIndex(x, k, 1)
+		}
+		previous = y
+	}
+	drawText(img, 4, 14, fmt.Sprintf("Mu=%.3f Sigma=%.3f", mu, sigma), palette[1])
+	return img
+}
+
+func RecordGrowthCurveGIF(path string, muStart, muEnd float64, steps int, sigma float64, width, height int) error {
+	// save an infinitely looping GIF of the growth mapping curve of width sigma, Mu going from muStart to muEnd
+	// in steps frames of width x height pixels, a Mu outside [0, 1] is drawn at the edge
+	if width < 2 || height < 2 {
+		return fmt.Errorf("the growth curve frames must be at least 2x2 pixels, got %dx%d", width, height)
+	}
+	if !(sigma > 0) {
+		return fmt.Errorf("the growth curve sigma must be positive, got %g", sigma)
+	}
+	if steps < 1 {
+		return fmt.Errorf("the growth curve animation needs at least one frame, got %d", steps)
+	}
+	if math.IsNaN(muStart) || math.IsNaN(muEnd) {
+		return fmt.Errorf("the growth curve Mu range must be numbers, got %g to %g", muStart, muEnd)
+	}
+	palette := color.Palette{color.Black, color.White, color.Gray{0x60}}
+	animation := &gif.GIF{LoopCount: 0}
+	for k := 0; k < steps; k++ {
+		mu := GridValue([2]float64{muStart, muEnd}, k, steps)
+		frame := growthCurveFrame(mu, sigma, width, height, palette)
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 8)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return gif.EncodeAll(file, animation)
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"image/gif"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGrowthCurveGIFSize(t *testing.T) {
+	// the frames have the requested size and the animation loops forever
+	path := filepath.Join(t.TempDir(), "growth.gif")
+	if err := RecordGrowthCurveGIF(path, 0.1, 0.3, 5, 0.02, 120, 80); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	animation, err := gif.DecodeAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(animation.Image) != 5 || animation.LoopCount != 0 {
+		t.Fatalf("%d frames looping %d times, want 5 frames looping forever (0)", len(animation.Image), animation.LoopCount)
+	}
+	if size := animation.Image[0].Bounds().Size(); size.X != 120 || size.Y != 80 {
+		t.Fatalf("frames of %v, want 120x80", size)
+	}
+	if err := RecordGrowthCurveGIF(path, 0.1, 0.3, 5, 0.02, 1, 80); err == nil {
+		t.Fatal("a frame 1 pixel wide is accepted")
+	}
+}
+
+func TestGrowthCurveGIFArguments(t *testing.T) {
+	// invalid arguments are errors instead of endless drawing, Mu out of [0, 1] stays in the frame
+	path := filepath.Join(t.TempDir(), "growth.gif")
+	for _, args := range []struct {
+		muStart, muEnd, sigma float64
+		steps                 int
+	}{{0, 0.3, 0, 5}, {0, 0.3, math.NaN(), 5}, {0, 0.3, -0.01, 5}, {0.1, 0.3, 0.02, 0}, {math.NaN(), 0.3, 0.02, 5}} {
+		if err := RecordGrowthCurveGIF(path, args.muStart, args.muEnd, args.steps, args.sigma, 64, 48); err == nil {
+			t.Fatalf("%+v accepted", args)
+		}
+	}
+	if err := RecordGrowthCurveGIF(path, -0.5, 1.5, 5, 1e-9, 64, 48); err != nil {
+		t.Fatal(err)
+	}
+}
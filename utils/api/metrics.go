@@ -0,0 +1,206 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"rd/utils"
+)
+
+// cells above this value are part of a component
+var ComponentThreshold = 0.1
+
+// at most this number of steps are kept in the metric series, the oldest ones are dropped
+const maxSeriesLength = 100000
+
+// keeps the duration of the last simulation step and the series of the metrics of each step
+type StatsTracker struct {
+	lock         sync.Mutex
+	stepDuration time.Duration
+	// ring buffers of the series, the oldest entry is at first once they are full
+	steps   []int
+	metrics []utils.RunMetrics
+	first   int
+	params  utils.Params
+}
+
+type ManageStatsTracker interface {
+	Record()
+	StepDuration()
+	RecordMetrics()
+	Series()
+	SetParams()
+	Title()
+}
+
+func (t *StatsTracker) Record(d time.Duration) {
+	// record the duration of a step
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.stepDuration = d
+}
+
+func (t *StatsTracker) StepDuration() time.Duration {
+	// duration of the last recorded step
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.stepDuration
+}
+
+func (t *StatsTracker) RecordMetrics(step int, m utils.RunMetrics) {
+	// append the metrics of a step to the series, replacing the oldest one when full
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if len(t.steps) < maxSeriesLength {
+		t.steps = append(t.steps, step)
+		t.metrics = append(t.metrics, m)
+		return
+	}
+	t.steps[t.first], t.metrics[t.first] = step, m
+	t.first = (t.first + 1) % maxSeriesLength
+}
+
+func (t *StatsTracker) Series() (steps []int, metrics []utils.RunMetrics) {
+	// copy of the recorded series, from the oldest step
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	steps = append(append([]int(nil), t.steps[t.first:]...), t.steps[:t.first]...)
+	metrics = append(append([]utils.RunMetrics(nil), t.metrics[t.first:]...), t.metrics[:t.first]...)
+	return steps, metrics
+}
+
+func (t *StatsTracker) SetParams(p utils.Params) {
+	// parameters of the run, shown in the title of the charts
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.params = p
+}
+
+func (t *StatsTracker) Title() string {
+	// description of the run parameters
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	p := t.params
+	return fmt.Sprintf("%dx%d, R=%g T=%g Mu=%g Sigma=%g Beta=%s", p.Width, p.Height, p.R, p.T, p.Mu, p.Sigma, utils.BetaToFlag(p.Beta))
+}
+
+func ServeMetrics(addr string, setup *utils.SafeConfig, tracker *StatsTracker) error {
+	// serve the simulation statistics at /metrics in the prometheus text format
+	// and the parameters at /params, read with GET and changed with POST
+	// it blocks like http.ListenAndServe
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, metricsText(setup, tracker))
+	})
+	mux.HandleFunc("/params", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if err := updateParams(setup, r); err != nil {
+				var invalid *utils.ConfigError
+				if errors.As(err, &invalid) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusBadRequest)
+					json.NewEncoder(w).Encode(map[string][]string{"violations": invalid.Violations})
+				} else {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+				}
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(currentParams(setup))
+	})
+	return http.ListenAndServe(addr, mux)
+}
+
+func currentParams(setup *utils.SafeConfig) utils.Params {
+	// parameters of the running simulation
+	var p utils.Params
+	setup.ReadState(func(c *utils.Config) {
+		p = utils.Params{R: c.R, T: c.T, Mu: c.Mu, Sigma: c.Sigma, Beta: append([]float64(nil), c.Beta...)}
+		p.Height, p.Width = c.A.Dims()
+	})
+	return p
+}
+
+func updateParams(setup *utils.SafeConfig, r *http.Request) error {
+	// apply the JSON parameters of the request body, the missing ones keep their current value
+	// nothing is changed unless every parameter is valid, the size of the world cannot change
+	current := currentParams(setup)
+	p := current
+	p.Beta = nil
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	if p.Beta == nil {
+		p.Beta = current.Beta
+	}
+	if p.Width != current.Width || p.Height != current.Height {
+		return fmt.Errorf("the world size cannot change, it is %dx%d", current.Width, current.Height)
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	var events *utils.EventBus
+	var step int
+	setup.WriteState(func(c *utils.Config) {
+		kernelChanged := c.R != p.R || !slices.Equal(c.Beta, p.Beta)
+		c.R, c.T, c.Mu, c.Sigma, c.Beta = p.R, p.T, p.Mu, p.Sigma, p.Beta
+		c.Dt = 1 / c.T
+		if kernelChanged {
+			c.ComputeKernel()
+		}
+		events, step = c.Events, c.Step
+	})
+	// named like the sliders so that they follow
+	for _, change := range []struct {
+		name          string
+		before, after float64
+	}{{"R", current.R, p.R}, {"T", current.T, p.T}, {"Mu", current.Mu, p.Mu}, {"Sigma", current.Sigma, p.Sigma}} {
+		if change.before != change.after {
+			events.Publish(utils.Event{Type: utils.EventParamChange, Step: step, Name: change.name, Value: change.after})
+		}
+	}
+	if !slices.Equal(current.Beta, p.Beta) {
+		events.Publish(utils.Event{Type: utils.EventParams, Step: step, Value: p.R, Beta: p.Beta})
+	}
+	return nil
+}
+
+func metricsText(setup *utils.SafeConfig, tracker *StatsTracker) string {
+	// gauges of the current state, computed with setup locked
+	var mean, variance, entropy, complexity, supportRadius float64
+	var components int
+	setup.ReadState(func(c *utils.Config) {
+		mean = utils.MeanState(c)
+		variance = utils.VarianceState(c)
+		entropy = utils.Entropy(c)
+		complexity = utils.MDLComplexity(c)
+		supportRadius = c.KernelSupportRadius
+		components, _ = utils.CountComponents(c, ComponentThreshold)
+	})
+	var b strings.Builder
+	gauge := func(name, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, value)
+	}
+	gauge("lenia_mean", "Mean value of the state.", mean)
+	gauge("lenia_variance", "Variance of the state values.", variance)
+	gauge("lenia_entropy", "Shannon entropy of the state histogram in bits.", entropy)
+	gauge("lenia_components", "Number of connected patterns.", float64(components))
+	gauge("lenia_complexity", "Compressed size of the 8-bit state over its raw size.", complexity)
+	gauge("lenia_kernel_support_radius", "Radius of the disk holding 99% of the kernel mass, in cells.", supportRadius)
+	gauge("lenia_step_duration_seconds", "Duration of the last simulation step.", tracker.StepDuration().Seconds())
+	return b.String()
+}
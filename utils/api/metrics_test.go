@@ -0,0 +1,25 @@
+package api
+
+import (
+	"testing"
+
+	"rd/utils"
+)
+
+func TestSeriesKeepsTheLastSteps(t *testing.T) {
+	// once full, the series drops its oldest steps and stays in step order
+	var tracker StatsTracker
+	total := maxSeriesLength + 10
+	for step := 0; step < total; step++ {
+		tracker.RecordMetrics(step, utils.RunMetrics{Mean: float64(step)})
+	}
+	steps, metrics := tracker.Series()
+	if len(steps) != maxSeriesLength || len(metrics) != maxSeriesLength {
+		t.Fatalf("got %d steps and %d metrics, want %d", len(steps), len(metrics), maxSeriesLength)
+	}
+	for k := range steps {
+		if want := total - maxSeriesLength + k; steps[k] != want || metrics[k].Mean != float64(want) {
+			t.Fatalf("entry %d is step %d, want %d", k, steps[k], want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+//go:build plot
+
+package api
+
+import (
+	"errors"
+	"os"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgpdf"
+
+	"rd/utils"
+)
+
+// whether the charts are compiled in, the metrics series are only worth recording then
+const PlotAvailable = true
+
+func PlotTimeSeries(tracker *StatsTracker, path string) error {
+	// save a PDF with one panel per metric over the steps, titled with the run parameters
+	steps, metrics := tracker.Series()
+	if len(steps) == 0 {
+		return errors.New("no metrics recorded")
+	}
+	series := []struct {
+		name  string
+		value func(utils.RunMetrics) float64
+	}{
+		{"mean", func(m utils.RunMetrics) float64 { return m.Mean }},
+		{"variance", func(m utils.RunMetrics) float64 { return m.Variance }},
+		{"entropy (bits)", func(m utils.RunMetrics) float64 { return m.Entropy }},
+		{"components", func(m utils.RunMetrics) float64 { return float64(m.Components) }},
+	}
+	plots := make([][]*plot.Plot, len(series))
+	for k, s := range series {
+		p := plot.New()
+		p.X.Label.Text = "step"
+		p.Y.Label.Text = s.name
+		points := make(plotter.XYs, len(steps))
+		for n := range steps {
+			points[n].X = float64(steps[n])
+			points[n].Y = s.value(metrics[n])
+		}
+		line, err := plotter.NewLine(points)
+		if err != nil {
+			return err
+		}
+		line.Color = plotutil.Color(k)
+		p.Add(plotter.NewGrid(), line)
+		p.Legend.Add(s.name, line)
+		p.Legend.Top = true
+		plots[k] = []*plot.Plot{p}
+	}
+	plots[0][0].Title.Text = tracker.Title()
+	// A4 portrait, the panels stacked with the same x axis width
+	pdf := vgpdf.New(21*vg.Centimeter, 29.7*vg.Centimeter)
+	tiles := draw.Tiles{
+		Rows:      len(series),
+		Cols:      1,
+		PadTop:    vg.Centimeter,
+		PadBottom: vg.Centimeter,
+		PadLeft:   vg.Centimeter,
+		PadRight:  vg.Centimeter,
+		PadY:      5 * vg.Millimeter,
+	}
+	canvases := plot.Align(plots, tiles, draw.New(pdf))
+	for k := range plots {
+		plots[k][0].Draw(canvases[k][0])
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := pdf.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,13 @@
+//go:build !plot
+
+package api
+
+import "errors"
+
+// whether the charts are compiled in, the metrics series are only worth recording then
+const PlotAvailable = false
+
+func PlotTimeSeries(tracker *StatsTracker, path string) error {
+	// gonum/plot is an optional dependency
+	return errors.New("charts need gonum.org/v1/plot, build with -tags plot")
+}
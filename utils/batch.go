@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"gonum.org/v1/gonum/mat"
+)
+
+// parameters of a run, as read from a TOML file
+type Params struct {
+	Width  int       `toml:"width" json:"width"`
+	Height int       `toml:"height" json:"height"`
+	R      float64   `toml:"r" json:"r"`
+	T      float64   `toml:"t" json:"t"`
+	Mu     float64   `toml:"mu" json:"mu"`
+	Sigma  float64   `toml:"sigma" json:"sigma"`
+	Beta   []float64 `toml:"beta" json:"beta"`
+}
+
+// one line of a batch output
+type BatchRecord struct {
+	Seed    int64              `json:"seed"`
+	Step    int                `json:"step"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// metrics that can be computed on a config, by name
+var Metrics = map[string]func(*Config) float64{
+	"mean":       MeanState,
+	"entropy":    Entropy,
+	"complexity": MDLComplexity,
+	"resonance":  GrowthResonance,
+	"components": func(c *Config) float64 {
+		count, _ := CountComponents(c, 0.1)
+		return float64(count)
+	},
+}
+
+func DefaultParams() Params {
+	// same defaults as the command line
+	return Params{
+		Width:  512,
+		Height: 512,
+		R:      80,
+		T:      40,
+		Mu:     0.23,
+		Sigma:  0.024,
+		Beta:   []float64{1, 0.6, 0.3},
+	}
+}
+
+func LoadParams(path string) (Params, error) {
+	// read parameters from a TOML file, missing keys keep their default value
+	p := DefaultParams()
+	if _, err := toml.DecodeFile(path, &p); err != nil {
+		return p, err
+	}
+	return p, p.Validate()
+}
+
+func (p Params) NewConfig(seed int64) (Config, error) {
+	// create a config from the parameters with a seeded initial state
+	c, err := NewConfig(p.Height, p.Width, p.R, p.T, p.Mu, p.Sigma, p.Beta)
+	if err != nil {
+		return Config{}, err
+	}
+	c.SetSeed(seed)
+	c.A.Zero()
+	c.InitState()
+	return c, nil
+}
+
+func RunBatch(p Params, steps int, metrics []string, rootSeed int64, runs, jobs int) ([]BatchRecord, error) {
+	// run runs simulations, jobs at a time, and collect the metrics at each step
+	// run k starts from the initial state drawn by InitStateBatch from the seed rootSeed+k
+	for _, name := range metrics {
+		if _, ok := Metrics[name]; !ok {
+			return nil, fmt.Errorf("unknown metric %q", name)
+		}
+	}
+	base, err := p.NewConfig(rootSeed)
+	if err != nil {
+		return nil, err
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+	if runs < 0 {
+		runs = 0
+	}
+	// the runs share the kernel of the base config, only their states differ
+	configs := make([]*Config, runs)
+	for k := range configs {
+		c := base.Clone()
+		configs[k] = &c
+	}
+	InitStateBatch(configs, rootSeed, jobs)
+	records := make([][]BatchRecord, runs)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range indexes {
+				c := configs[k]
+				for s := 0; s < steps; s++ {
+					c.Update()
+					record := BatchRecord{Seed: c.Seed, Step: c.Step, Metrics: map[string]float64{}}
+					for _, name := range metrics {
+						record.Metrics[name] = Metrics[name](c)
+					}
+					records[k] = append(records[k], record)
+				}
+			}
+		}()
+	}
+	for k := range configs {
+		indexes <- k
+	}
+	close(indexes)
+	wg.Wait()
+	var all []BatchRecord
+	for _, run := range records {
+		all = append(all, run...)
+	}
+	return all, nil
+}
+
+func InitStateBatch(configs []*Config, rootSeed int64, workers int) {
+	// draw a new random initial state for each config, workers at a time
+	// config k restarts its random source from rootSeed+k, so the states do not depend on the scheduling
+	if workers < 1 {
+		workers = 1
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range indexes {
+				c := configs[k]
+				c.SetSeed(rootSeed + int64(k))
+				c.A.Zero()
+				c.Step = 0
+				c.ClearHistory()
+				c.InitState()
+			}
+		}()
+	}
+	for k := range configs {
+		indexes <- k
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// a run is extinct once the mean of its state falls below this value
+const extinctionMean = 0.01
+
+func EstimateHeatDeathProbability(base Config, nTrials, steps int) float64 {
+	// fraction of nTrials runs of the base parameters, each from its own random initial state,
+	// that go extinct within steps steps: how robust the parameters are to the initial state
+	// trial k uses the seed base.Seed+k+1, the trials run in parallel
+	if nTrials < 1 {
+		return 0
+	}
+	h, w := base.A.Dims()
+	extinct := make([]bool, nTrials)
+	trials := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < runtime.NumCPU(); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range trials {
+				c := base.Clone()
+				c.SetSeed(base.Seed + int64(k) + 1)
+				c.A = mat.NewDense(h, w, nil)
+				c.InitState()
+				for s := 0; s < steps && !extinct[k]; s++ {
+					c.Update()
+					extinct[k] = MeanState(&c) < extinctionMean
+				}
+			}
+		}()
+	}
+	for k := 0; k < nTrials; k++ {
+		trials <- k
+	}
+	close(trials)
+	wg.Wait()
+	count := 0
+	for _, e := range extinct {
+		if e {
+			count++
+		}
+	}
+	return float64(count) / float64(nTrials)
+}
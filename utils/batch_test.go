@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestInitStateBatch(t *testing.T) {
+	// the states drawn in parallel match the sequential ones, whatever the number of workers
+	// run with go test -race to check the workers do not share anything
+	base := newTestConfig(t, 128, 0)
+	draw := func(workers int) []*Config {
+		configs := make([]*Config, 6)
+		for k := range configs {
+			c := base.Clone()
+			configs[k] = &c
+		}
+		InitStateBatch(configs, 10, workers)
+		return configs
+	}
+	sequential, parallel := draw(1), draw(4)
+	for k := range sequential {
+		want := newTestConfig(t, 128, 10+int64(k))
+		if !mat.Equal(sequential[k].A, want.A) || !mat.Equal(parallel[k].A, want.A) {
+			t.Fatalf("config %d: the state depends on the scheduling", k)
+		}
+		if parallel[k].Seed != 10+int64(k) {
+			t.Fatalf("config %d: seed %d, want %d", k, parallel[k].Seed, 10+k)
+		}
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	// a parallel batch gives the same records as a sequential one
+	p := Params{Width: 128, Height: 128, R: 13, T: 10, Mu: 0.15, Sigma: 0.015, Beta: []float64{1}}
+	metrics := []string{"mean", "entropy"}
+	sequential, err := RunBatch(p, 5, metrics, 3, 4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallel, err := RunBatch(p, 5, metrics, 3, 4, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parallel) != 4*5 {
+		t.Fatalf("%d records, want %d", len(parallel), 4*5)
+	}
+	for k := range sequential {
+		a, b := sequential[k], parallel[k]
+		if a.Seed != b.Seed || a.Step != b.Step || a.Metrics["mean"] != b.Metrics["mean"] || a.Metrics["entropy"] != b.Metrics["entropy"] {
+			t.Fatalf("record %d: %+v sequential, %+v parallel", k, a, b)
+		}
+	}
+	if sequential[0].Seed != 3 || sequential[len(sequential)-1].Seed != 6 {
+		t.Fatalf("seeds %d..%d, want 3..6", sequential[0].Seed, sequential[len(sequential)-1].Seed)
+	}
+}
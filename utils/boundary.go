@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"runtime"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// what happens at the edges of the world
+type BoundaryMode int
+
+const (
+	// the world wraps around (default)
+	BoundaryTorus BoundaryMode = iota
+	// nothing lives outside the world
+	BoundaryWall
+	// the world is mirrored at its edges
+	BoundaryReflect
+)
+
+var boundaryNames = map[string]BoundaryMode{
+	"torus":   BoundaryTorus,
+	"wall":    BoundaryWall,
+	"reflect": BoundaryReflect,
+}
+
+func FlagToBoundary(s string) (BoundaryMode, bool) {
+	// parse the -boundary flag value
+	mode, ok := boundaryNames[s]
+	return mode, ok
+}
+
+func reflectIndex(i, n int) int {
+	// index of the mirrored cell for an index out of [0, n)
+	if i < 0 {
+		return -i - 1
+	} else if i >= n {
+		return 2*n - i - 1
+	}
+	return i
+}
+
+func mirrorPadMatrix(m *mat.Dense, padding int) *mat.Dense {
+	// add mirrored padding around a matrix
+	h, w := m.Dims()
+	padded := mat.NewDense(h+2*padding, w+2*padding, nil)
+	padded.Apply(func(i, j int, _ float64) float64 {
+		return m.At(reflectIndex(i-padding, h), reflectIndex(j-padding, w))
+	}, padded)
+	return padded
+}
+
+func (c *Config) boundedPotential() *mat.Dense {
+	// compute the potential of a non wrapping world by padding it with the kernel radius
+	// so that the circular FFT convolution does not reach the other side
+	h, w := c.A.Dims()
+	p := c.kernelRadius()
+	var padded *mat.Dense
+	if c.Boundary == BoundaryReflect {
+		padded = mirrorPadMatrix(c.A, p)
+	} else {
+		padded = padMatrix(c.A, p)
+	}
+	if c.directConvolution() {
+		return convolvePadded(padded, c.Kernel, runtime.NumCPU())
+	}
+	// the kernel FFT at the padded size is kept until the kernel changes
+	if c.padKFFT == nil {
+		c.padKFFT = HalfFFT(FFTShift(c.Kernel, h+2*p, w+2*p))
+	}
+	U := HalfIFFT(ComplexMulElem(c.padKFFT, HalfFFT(padded)), h+2*p)
+	return mat.DenseCopyOf(U.Slice(p, h+p, p, w+p))
+}
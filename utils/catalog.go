@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// size of the image the perceptual hash is computed on, and of the kept low frequencies
+const hashSize = 32
+const hashLowSize = 8
+
+func PatternHash(c *Config, threshold float64) uint64 {
+	// perceptual hash (pHash) of the bounding box of the cells above threshold, 0 when there is none
+	// the box is resized to 32x32 so the hash does not depend on the position of the pattern,
+	// then each of the 8x8 lowest frequencies of its DCT (without the constant one) gives a bit,
+	// set when it is above their median
+	x, y, w, h := BoundingBox(c, threshold)
+	if w == 0 {
+		return 0
+	}
+	region := CopyRegion(c, x, y, w, h)
+	small := mat.NewDense(hashSize, hashSize, nil)
+	small.Apply(func(i, j int, _ float64) float64 {
+		return region.At(i*w/hashSize, j*h/hashSize)
+	}, small)
+	frequencies := dct2(small)
+	low := make([]float64, 0, hashLowSize*hashLowSize-1)
+	for u := 0; u < hashLowSize; u++ {
+		for v := 0; v < hashLowSize; v++ {
+			if u != 0 || v != 0 {
+				low = append(low, frequencies.At(u, v))
+			}
+		}
+	}
+	sorted := append([]float64(nil), low...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+	var hash uint64
+	for k, f := range low {
+		if f > median {
+			hash |= 1 << k
+		}
+	}
+	// the bit of the constant frequency tells an empty box from the rest
+	return hash | 1<<63
+}
+
+func dct2(m *mat.Dense) *mat.Dense {
+	// 2D discrete cosine transform (type II) of a square matrix, computed row then column wise
+	n, _ := m.Dims()
+	cos := mat.NewDense(n, n, nil)
+	cos.Apply(func(u, i int, _ float64) float64 {
+		return math.Cos(math.Pi * float64(u) * (2*float64(i) + 1) / float64(2*n))
+	}, cos)
+	var rows, result mat.Dense
+	rows.Mul(cos, m)
+	result.Mul(&rows, cos.T())
+	return &result
+}
+
+// distinct patterns seen during a run, each one saved as an image the first time
+type CreatureCatalog struct {
+	// step at which each pattern hash was first seen
+	Hashes map[uint64]int
+	Dir    string
+	// hashes differing by at most this number of bits are the same pattern, as a moving or
+	// slowly changing pattern rarely keeps exactly the same hash
+	MaxDistance int
+	// minimum number of steps between two saves
+	MinInterval int
+	// step of the last save, -1 before the first one
+	lastSave int
+}
+
+type ManageCreatureCatalog interface {
+	Observe()
+}
+
+// defaults of NewCreatureCatalog: 10 bits out of 64 and one save every 100 steps at most
+const catalogMaxDistance = 10
+const catalogMinInterval = 100
+
+func NewCreatureCatalog(dir string) (*CreatureCatalog, error) {
+	// create an empty catalog saving its snapshots in dir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &CreatureCatalog{
+		Hashes:      map[uint64]int{},
+		Dir:         dir,
+		MaxDistance: catalogMaxDistance,
+		MinInterval: catalogMinInterval,
+		lastSave:    -1,
+	}, nil
+}
+
+func (cat *CreatureCatalog) known(hash uint64) bool {
+	// whether a pattern close enough to hash was already seen
+	for seen := range cat.Hashes {
+		if bits.OnesCount64(hash^seen) <= cat.MaxDistance {
+			return true
+		}
+	}
+	return false
+}
+
+func (cat *CreatureCatalog) Observe(c *Config, threshold float64) (bool, error) {
+	// hash the current pattern and save a snapshot of it if no close pattern was seen
+	// nothing is observed less than MinInterval steps after the last save (the step can go back after a restart)
+	if cat.lastSave >= 0 && c.Step >= cat.lastSave && c.Step-cat.lastSave < cat.MinInterval {
+		return false, nil
+	}
+	hash := PatternHash(c, threshold)
+	if hash == 0 || cat.known(hash) {
+		return false, nil
+	}
+	cat.Hashes[hash] = c.Step
+	cat.lastSave = c.Step
+	x, y, w, h := BoundingBox(c, threshold)
+	region := CopyRegion(c, x, y, w, h)
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i := 0; i < w; i++ {
+		for j := 0; j < h; j++ {
+			img.SetGray(i, j, color.Gray{uint8(Clip(region.At(i, j), 0, 1) * 255)})
+		}
+	}
+	path := filepath.Join(cat.Dir, fmt.Sprintf("%016x-step%d.png", hash, c.Step))
+	return true, savePNG(img, path)
+}
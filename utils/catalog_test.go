@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+func drawBlob(c *Config, x, y int, stretch float64) {
+	// draw a smooth blob of radius 10 centered on (x, y), stretched along the rows
+	for i := -20; i <= 20; i++ {
+		for j := -20; j <= 20; j++ {
+			d := math.Hypot(float64(i)/stretch, float64(j))
+			if d < 10 {
+				c.A.Set(x+i, y+j, 1-d/10)
+			}
+		}
+	}
+}
+
+func TestCatalogKeepsOneSnapshotPerPattern(t *testing.T) {
+	// a pattern moving and changing slightly is saved once, a different one after the interval
+	c := newTestConfig(t, 128, 1)
+	cat, err := NewCreatureCatalog(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	observe := func(step int, want bool) {
+		t.Helper()
+		c.Step = step
+		saved, err := cat.Observe(&c, 0.1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved != want {
+			t.Fatalf("step %d: saved %t, want %t", step, saved, want)
+		}
+	}
+	c.A.Zero()
+	drawBlob(&c, 40, 40, 1.5)
+	observe(0, true)
+	for step := 1; step < 5*catalogMinInterval; step += 7 {
+		c.A.Zero()
+		drawBlob(&c, 40+step%50, 40, 1.47+float64(step%4)*0.03)
+		observe(step, false)
+	}
+	// a pair of blobs is new, but only saved once the interval since the last save has passed
+	c.A.Zero()
+	drawBlob(&c, 40, 40, 1.5)
+	drawBlob(&c, 40, 70, 1.5)
+	observe(catalogMinInterval/2, false)
+	observe(catalogMinInterval, true)
+	files, err := os.ReadDir(cat.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || len(cat.Hashes) != 2 {
+		t.Fatalf("%d snapshots and %d hashes, want 2", len(files), len(cat.Hashes))
+	}
+}
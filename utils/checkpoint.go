@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"encoding/gob"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// what is written to disk for a checkpoint
+// fields added later are zero when reading older checkpoints
+type checkpoint struct {
+	R, T, Mu, Sigma float64
+	Beta            []float64
+	State           []byte
+	// everything else needed to continue the run exactly
+	Seed                      int64
+	Step                      int
+	Boundary                  BoundaryMode
+	KernelCore                KernelCoreType
+	GridType                  GridType
+	KernelAspect, KernelAngle float64
+	UseAsymmetricKernel       bool
+	KernelAngleBias           float64
+	ClipMode                  ClipMode
+	ClipSteepness             float64
+	FastMath                  bool
+	PerceptualColormap        bool
+	FFTPadFactor              int
+	OffsetX, OffsetY          int
+	MuMap, SigmaMap           []byte
+	Mask                      []byte
+}
+
+func marshalOptional(m *mat.Dense) ([]byte, error) {
+	// binary form of a matrix that can be nil
+	if m == nil {
+		return nil, nil
+	}
+	return m.MarshalBinary()
+}
+
+func unmarshalOptional(data []byte) (*mat.Dense, error) {
+	// matrix written by marshalOptional
+	if len(data) == 0 {
+		return nil, nil
+	}
+	m := &mat.Dense{}
+	if err := m.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func SaveCheckpoint(c *Config, path string) error {
+	// save the parameters and the current state to a file
+	state, err := c.A.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	muMap, err := marshalOptional(c.MuMap)
+	if err != nil {
+		return err
+	}
+	sigmaMap, err := marshalOptional(c.SigmaMap)
+	if err != nil {
+		return err
+	}
+	mask, err := marshalOptional(c.Mask)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return gob.NewEncoder(file).Encode(checkpoint{
+		R:                   c.R,
+		T:                   c.T,
+		Mu:                  c.Mu,
+		Sigma:               c.Sigma,
+		Beta:                c.Beta,
+		State:               state,
+		Seed:                c.Seed,
+		Step:                c.Step,
+		Boundary:            c.Boundary,
+		KernelCore:          c.KernelCore,
+		GridType:            c.GridType,
+		KernelAspect:        c.KernelAspect,
+		KernelAngle:         c.KernelAngle,
+		UseAsymmetricKernel: c.UseAsymmetricKernel,
+		KernelAngleBias:     c.KernelAngleBias,
+		ClipMode:            c.ClipMode,
+		ClipSteepness:       c.ClipSteepness,
+		FastMath:            c.FastMath,
+		PerceptualColormap:  c.PerceptualColormap,
+		FFTPadFactor:        c.FFTPadFactor,
+		OffsetX:             c.offsetX,
+		OffsetY:             c.offsetY,
+		MuMap:               muMap,
+		SigmaMap:            sigmaMap,
+		Mask:                mask,
+	})
+}
+
+func LoadCheckpoint(path string) (Config, error) {
+	// rebuild a config from a checkpoint file
+	// updates then give the same states as the saved run would have
+	file, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer file.Close()
+	var cp checkpoint
+	if err := gob.NewDecoder(file).Decode(&cp); err != nil {
+		return Config{}, err
+	}
+	A := &mat.Dense{}
+	if err := A.UnmarshalBinary(cp.State); err != nil {
+		return Config{}, err
+	}
+	h, w := A.Dims()
+	c, err := NewConfig(h, w, cp.R, cp.T, cp.Mu, cp.Sigma, cp.Beta)
+	if err != nil {
+		return Config{}, err
+	}
+	c.A = A
+	if c.MuMap, err = unmarshalOptional(cp.MuMap); err != nil {
+		return Config{}, err
+	}
+	if c.SigmaMap, err = unmarshalOptional(cp.SigmaMap); err != nil {
+		return Config{}, err
+	}
+	if c.Mask, err = unmarshalOptional(cp.Mask); err != nil {
+		return Config{}, err
+	}
+	c.Step = cp.Step
+	c.Boundary = cp.Boundary
+	c.ClipMode = cp.ClipMode
+	if cp.ClipSteepness != 0 {
+		c.ClipSteepness = cp.ClipSteepness
+	}
+	c.FastMath = cp.FastMath
+	c.PerceptualColormap = cp.PerceptualColormap
+	if cp.FFTPadFactor != 0 {
+		c.FFTPadFactor = cp.FFTPadFactor
+	}
+	// the saved state is already translated
+	c.OffsetX, c.OffsetY = cp.OffsetX, cp.OffsetY
+	c.offsetX, c.offsetY = cp.OffsetX, cp.OffsetY
+	if cp.KernelCore != c.KernelCore || cp.GridType != c.GridType || (cp.KernelAspect != 0 && cp.KernelAspect != c.KernelAspect) || cp.KernelAngle != c.KernelAngle ||
+		cp.UseAsymmetricKernel != c.UseAsymmetricKernel || cp.KernelAngleBias != c.KernelAngleBias {
+		c.KernelCore = cp.KernelCore
+		c.GridType = cp.GridType
+		if cp.KernelAspect != 0 {
+			c.KernelAspect = cp.KernelAspect
+		}
+		c.KernelAngle = cp.KernelAngle
+		c.UseAsymmetricKernel = cp.UseAsymmetricKernel
+		c.KernelAngleBias = cp.KernelAngleBias
+		if err := ValidateConfig(&c); err != nil {
+			return Config{}, err
+		}
+		c.ComputeKernel()
+	}
+	// the random source restarts from the saved seed, the initial state of NewConfig is not kept
+	// 0 is a seed like any other (the first batch run uses it)
+	c.SetSeed(cp.Seed)
+	return c, nil
+}
+
+func AutoSave(setup *SafeConfig, dir string, interval time.Duration) (cancel func()) {
+	// save a checkpoint in dir at every interval until cancel is called
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		slog.Warn("auto-save disabled", "err", err)
+		return func() {}
+	}
+	ticker := time.NewTicker(interval)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case t := <-ticker.C:
+				date := fmt.Sprintf("%d-%02d-%02dT%02d:%02d:%02d",
+					t.Year(), t.Month(), t.Day(),
+					t.Hour(), t.Minute(), t.Second())
+				path := filepath.Join(dir, date+".gob")
+				var err error
+				var events *EventBus
+				var step int
+				setup.ReadState(func(c *Config) {
+					err = SaveCheckpoint(c, path)
+					events, step = c.Events, c.Step
+				})
+				if err != nil {
+					slog.Error("auto-save failed", "err", err)
+				} else {
+					events.Publish(Event{Type: EventSave, Step: step, Path: path})
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		// stop the ticker and wait for the goroutine to exit
+		once.Do(func() {
+			ticker.Stop()
+			close(stop)
+			<-done
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"math"
+)
+
+// how the state is kept between 0 and 1 after each update
+type ClipMode int
+
+const (
+	// values are cut at 0 and 1 (default)
+	ClipHard ClipMode = iota
+	// values outside [0, 1] are compressed by a sigmoid-shaped tail, with no sharp cut at 0 and 1
+	ClipSoft
+)
+
+// steepness of the soft clip sigmoid used by NewConfig
+const DefaultClipSteepness = 10
+
+var clipNames = map[string]ClipMode{
+	"hard": ClipHard,
+	"soft": ClipSoft,
+}
+
+func FlagToClipMode(s string) (ClipMode, bool) {
+	// parse the -clip flag value
+	mode, ok := clipNames[s]
+	return mode, ok
+}
+
+func SoftClip(v, k float64) float64 {
+	// values in [0, 1] are kept, the ones outside are compressed by a tanh tail with a slope of 1
+	// at the bounds, so that the state never goes further than 1/k outside [0, 1]
+	switch {
+	case v < 0:
+		return math.Tanh(k*v) / k
+	case v > 1:
+		return 1 + math.Tanh(k*(v-1))/k
+	}
+	return v
+}
+
+func (c *Config) clip(v float64) float64 {
+	// keep a state value between 0 and 1 according to the clip mode
+	if c.ClipMode == ClipSoft {
+		return SoftClip(v, c.ClipSteepness)
+	}
+	return Clip(v, 0, 1)
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestSoftClip(t *testing.T) {
+	// the values inside [0, 1] are kept, the others are compressed towards the bounds
+	k := float64(DefaultClipSteepness)
+	for _, v := range []float64{0, 0.01, 0.5, 0.99, 1} {
+		if got := SoftClip(v, k); got != v {
+			t.Errorf("SoftClip(%g) = %g, want %g", v, got, v)
+		}
+	}
+	previous := SoftClip(-10, k)
+	for n := -1000; n <= 1100; n++ {
+		v := float64(n) / 100
+		got := SoftClip(v, k)
+		if got < previous {
+			t.Fatalf("SoftClip is not monotonic at %g", v)
+		}
+		if got < -1/k || got > 1+1/k {
+			t.Fatalf("SoftClip(%g) = %g, further than 1/k from [0, 1]", v, got)
+		}
+		if (v < 0 && (got >= 0 || got < v)) || (v > 1 && (got <= 1 || got > v)) {
+			t.Fatalf("SoftClip(%g) = %g is not compressed towards [0, 1]", v, got)
+		}
+		previous = got
+	}
+}
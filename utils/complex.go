@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"image/color"
+	"math"
+	"math/cmplx"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// a world whose cells hold a magnitude and a phase
+// the embedded config holds the parameters and kernel, its A is the magnitude of the state
+type ComplexConfig struct {
+	Config
+	A *mat.CDense
+}
+
+type ManageComplexConfig interface {
+	Magnitude()
+	GrowthMapping()
+	Update()
+	GetColor()
+}
+
+func NewComplexConfig(h, w int, R, T, Mu, Sigma float64, Beta []float64) (ComplexConfig, error) {
+	// create a complex config, the initial magnitude is the usual initial state with random phases
+	base, err := NewConfig(h, w, R, T, Mu, Sigma, Beta)
+	if err != nil {
+		return ComplexConfig{}, err
+	}
+	c := ComplexConfig{Config: base}
+	c.A = mat.NewCDense(h, w, nil)
+	for i := 0; i < h; i++ {
+		for j := 0; j < w; j++ {
+			phase := 2 * math.Pi * c.random().Float64()
+			c.A.Set(i, j, cmplx.Rect(c.Config.A.At(i, j), phase))
+		}
+	}
+	return c, nil
+}
+
+func (c *ComplexConfig) Magnitude() *mat.Dense {
+	// |A| for each cell
+	h, w := c.A.Dims()
+	m := mat.NewDense(h, w, nil)
+	m.Apply(func(i, j int, _ float64) float64 {
+		return cmplx.Abs(c.A.At(i, j))
+	}, m)
+	return m
+}
+
+func (c *ComplexConfig) GrowthMapping(U *mat.Dense) *mat.Dense {
+	// same growth as the real world, the potential being computed from |A|
+	return c.Config.GrowthMapping(U)
+}
+
+func (c *ComplexConfig) Update() {
+	// compute the next state: the magnitude grows as in the real world and the phase is kept
+	c.Config.A = c.Magnitude()
+	G := c.GrowthMapping(c.Potential())
+	h, w := c.A.Dims()
+	for i := 0; i < h; i++ {
+		for j := 0; j < w; j++ {
+			z := c.A.At(i, j)
+			magnitude := Clip(c.Config.A.At(i, j)+c.Dt*G.At(i, j), 0, 1)
+			c.A.Set(i, j, cmplx.Rect(magnitude, cmplx.Phase(z)))
+		}
+	}
+	c.Config.A = c.Magnitude()
+	c.Step++
+}
+
+func (c *ComplexConfig) GetColor(i, j int) color.Color {
+	// magnitude as luminance and phase as hue
+	z := c.A.At(i, j)
+	return hsvColor(cmplx.Phase(z)*180/math.Pi, 1, Clip(cmplx.Abs(z), 0, 1))
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func TestComplexUpdateKeepsPhase(t *testing.T) {
+	// the magnitude follows the growth and stays in [0,1], the phase of the cells alive
+	// before and after the step is kept (a cell reaching 0 has no phase left)
+	c, err := NewComplexConfig(128, 128, 13, 10, 0.15, 0.015, []float64{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := append([]complex128(nil), c.A.RawCMatrix().Data...)
+	c.Update()
+	for k, z := range c.A.RawCMatrix().Data {
+		if m := cmplx.Abs(z); m < 0 || m > 1+1e-12 {
+			t.Fatalf("cell %d: magnitude %g out of [0,1]", k, m)
+		}
+		if cmplx.Abs(before[k]) > 0 && cmplx.Abs(z) > 0 && math.Abs(cmplx.Phase(z)-cmplx.Phase(before[k])) > 1e-9 {
+			t.Fatalf("cell %d: phase %g, was %g", k, cmplx.Phase(z), cmplx.Phase(before[k]))
+		}
+	}
+	if !denseWithin(c.Config.A, c.Magnitude(), 0) {
+		t.Fatal("the real state is not the magnitude")
+	}
+}
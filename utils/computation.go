@@ -1,37 +1,162 @@
 package utils
 
 import (
+	"fmt"
 	"math"
+	"math/cmplx"
 	"math/rand"
+	"runtime"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/mjibson/go-dsp/fft"
+	"gonum.org/v1/gonum/dsp/fourier"
 	"gonum.org/v1/gonum/floats"
 	"gonum.org/v1/gonum/mat"
 )
 
-// for random generation
-var r0 = rand.New(rand.NewSource(time.Now().UnixNano()))
+// kernel radius under which the potential is computed by direct convolution instead of FFT
+const directConvolutionRadius = 20
+
+// kernel core function used in each ring of the kernel shell
+type KernelCoreType int
+
+const (
+	// exponential core (default)
+	KernelExp KernelCoreType = iota
+	// polynomial core
+	KernelPoly
+)
+
+var kernelCoreNames = map[string]KernelCoreType{
+	"exp":  KernelExp,
+	"poly": KernelPoly,
+}
+
+func FlagToKernelCore(s string) (KernelCoreType, bool) {
+	// parse the -core flag value
+	core, ok := kernelCoreNames[s]
+	return core, ok
+}
+
+// lattice the world cells are on
+type GridType int
+
+const (
+	// square cells (default)
+	GridSquare GridType = iota
+	// hexagonal cells stored in axial coordinates: the neighbors of (i, j) are
+	// (i±1, j), (i, j±1), (i+1, j-1) and (i-1, j+1)
+	GridHex
+)
+
+var gridNames = map[string]GridType{
+	"square": GridSquare,
+	"hex":    GridHex,
+}
+
+func FlagToGridType(s string) (GridType, bool) {
+	// parse the -grid flag value
+	grid, ok := gridNames[s]
+	return grid, ok
+}
 
 type Config struct {
 	// matrices
 	A, Kernel, G *mat.Dense
-	KFFT         *mat.CDense
+	// FFT of the kernel at the world size, first half of the rows only (see HalfFFT)
+	KFFT *mat.CDense
+	// radius of the disk holding 99% of the kernel mass, updated with the kernel
+	KernelSupportRadius float64
 	// parameters
 	R, T, Mu, Sigma, Dx, Dt float64
 	Beta                    []float64
+	Boundary                BoundaryMode
+	KernelCore              KernelCoreType
+	GridType                GridType
+	// elliptical kernel, ratio of its axes (1 for a circle, 0 is treated as 1) and angle in radians
+	KernelAspect, KernelAngle float64
+	// directionally biased kernel, its distances are stretched towards the angle KernelAngleBias (in radians)
+	UseAsymmetricKernel bool
+	KernelAngleBias     float64
+	// hard or soft clip of the state, with the steepness of the soft one
+	ClipMode      ClipMode
+	ClipSteepness float64
+	// per cell Mu and Sigma, the scalars are used when nil
+	MuMap, SigmaMap *mat.Dense
+	// cells where the mask is below 0.5 are kept at 0 (outside of the arena), nil for no mask
+	Mask *mat.Dense
+	// use an approximated exponential in the growth mapping
+	FastMath bool
+	// draw the state with the colormap gradients interpolated in CIELAB instead of RGB
+	PerceptualColormap bool
+	// number of updates since the start
+	Step int
+	// kinetic energy of the last update
+	Energy float64
+	// cyclic translation of the world, applied to A at the next update
+	OffsetX, OffsetY int
+	// translation already applied to A
+	offsetX, offsetY int
+	// number of previous states kept for StepBack (0 to keep none)
+	HistoryDepth              int
+	history                   []historyEntry
+	historyNext, historyCount int
+	// receives the events of the config (EventStep after each update), can be nil
+	Events *EventBus
+	// seed of the config own random source
+	Seed int64
+	rng  *rand.Rand
+	// kernel FFT at the padded size used by non wrapping boundaries
+	padKFFT *mat.CDense
+	// the state is zero-padded to FFTPadFactor times its size before the FFT convolution (1 for no padding)
+	FFTPadFactor int
+	// kernel FFT at the size given by FFTPadFactor, with the factor it was computed for
+	factorKFFT *mat.CDense
+	kfftFactor int
+	// incremented each time the kernel changes
+	kernelVersion int
+	// steps at which EventBreakpoint is published, to pause the simulation
+	Breakpoints []int
 }
 
 type compute interface {
 	InitState()
+	Reset()
 	ComputeKernel()
 	GrowthMapping()
 	Update()
 }
 
-func randInt(min, max int) int {
+func randInt(r *rand.Rand, min, max int) int {
 	// random nteger between min and max
-	return r0.Intn(max-min) + min
+	return r.Intn(max-min) + min
+}
+
+func (c *Config) random() *rand.Rand {
+	// random source of the config, created from its seed on first use
+	if c.rng == nil {
+		c.rng = rand.New(rand.NewSource(c.Seed))
+	}
+	return c.rng
+}
+
+func (c *Config) Clone() Config {
+	// copy of the config that can run on its own: its own state and random source, no events and no history
+	clone := *c
+	clone.A = mat.DenseCopyOf(c.A)
+	clone.Events = nil
+	clone.HistoryDepth = 0
+	clone.ClearHistory()
+	clone.rng = nil
+	return clone
+}
+
+func (c *Config) SetSeed(seed int64) {
+	// restart the config random source from a seed
+	c.Seed = seed
+	c.rng = rand.New(rand.NewSource(seed))
 }
 
 func mod(a, b int) int {
@@ -92,20 +217,105 @@ func IFFT(m *mat.CDense) *mat.CDense {
 	return ComplexSliceToDense(fft.IFFT2(ComplexDenseToSlice(m)))
 }
 
+func HalfFFT(m *mat.Dense) *mat.CDense {
+	// FFT of a real matrix keeping only its first r/2+1 rows, half of the memory of FFT:
+	// as the matrix is real, the other rows are the conjugates F(i, j) = conj(F(r-i, -j))
+	// real FFT of each column then complex FFT of each kept row, unnormalized like FFT
+	r, c := m.Dims()
+	half := mat.NewCDense(r/2+1, c, nil)
+	columnFFT := fourier.NewFFT(r)
+	column := make([]float64, r)
+	coefficients := make([]complex128, r/2+1)
+	for j := 0; j < c; j++ {
+		mat.Col(column, j, m)
+		columnFFT.Coefficients(coefficients, column)
+		for i, z := range coefficients {
+			half.Set(i, j, z)
+		}
+	}
+	rowFFT := fourier.NewCmplxFFT(c)
+	data := half.RawCMatrix()
+	for i := 0; i < r/2+1; i++ {
+		row := data.Data[i*data.Stride : i*data.Stride+c]
+		rowFFT.Coefficients(row, row)
+	}
+	return half
+}
+
+func HalfIFFT(m *mat.CDense, r int) *mat.Dense {
+	// inverse of HalfFFT for a matrix of r rows, normalized like IFFT
+	rows, c := m.Dims()
+	half := mat.NewCDense(rows, c, nil)
+	half.Copy(m)
+	rowFFT := fourier.NewCmplxFFT(c)
+	data := half.RawCMatrix()
+	for i := 0; i < rows; i++ {
+		row := data.Data[i*data.Stride : i*data.Stride+c]
+		rowFFT.Sequence(row, row)
+	}
+	result := mat.NewDense(r, c, nil)
+	columnFFT := fourier.NewFFT(r)
+	column := make([]float64, r)
+	coefficients := make([]complex128, rows)
+	scale := 1 / float64(r*c)
+	for j := 0; j < c; j++ {
+		for i := range coefficients {
+			coefficients[i] = half.At(i, j)
+		}
+		columnFFT.Sequence(column, coefficients)
+		for i, v := range column {
+			result.Set(i, j, v*scale)
+		}
+	}
+	return result
+}
+
+func FullSpectrum(m *mat.CDense, r int) *mat.CDense {
+	// the r rows FFT of a real matrix from its first rows given by HalfFFT
+	rows, c := m.Dims()
+	full := mat.NewCDense(r, c, nil)
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			if i < rows {
+				full.Set(i, j, m.At(i, j))
+			} else {
+				full.Set(i, j, cmplx.Conj(m.At(r-i, mod(-j, c))))
+			}
+		}
+	}
+	return full
+}
+
 func FFTShift(m *mat.Dense, r, c int) *mat.Dense {
 	// FFT shift, transform a kernel matrix for example by shifting its center to the top left of a bigger matrix
+	// any size works as the FFT is not restricted to powers of two (only faster with them)
+	// when the kernel is wider than the matrix, the values landing on the same cell are summed
+	// so that the shifted kernel is the periodic one of the circular convolution
 	shifted := mat.NewDense(r, c, nil)
 	width, _ := m.Dims()
 	R := int((width - 1) / 2)
 	for i := -R; i <= R; i++ {
 		for j := -R; j <= R; j++ {
 			v := m.At(i+R, j+R)
-			shifted.Set(mod(i, c), mod(j, c), v)
+			shifted.Set(mod(i, r), mod(j, c), shifted.At(mod(i, r), mod(j, c))+v)
 		}
 	}
 	return shifted
 }
 
+func CenteredLogMagnitude(m *mat.CDense) *mat.Dense {
+	// log(1+|z|) of a spectrum scaled between 0 and 1, with the zero frequency moved to the center
+	r, c := m.Dims()
+	magnitude := mat.NewDense(r, c, nil)
+	magnitude.Apply(func(i, j int, _ float64) float64 {
+		return math.Log1p(cmplx.Abs(m.At(mod(i-r/2, r), mod(j-c/2, c))))
+	}, magnitude)
+	if max := mat.Max(magnitude); max > 0 {
+		magnitude.Scale(1/max, magnitude)
+	}
+	return magnitude
+}
+
 func RealPart(m *mat.CDense) *mat.Dense {
 	// returns only the real parts of a complex matrix
 	r, c := m.Dims()
@@ -125,7 +335,7 @@ func ComplexMulElem(m1, m2 *mat.CDense) *mat.CDense {
 	for i := 0; i < r; i++ {
 		//wg.Add(1)
 		//go func() {
-		for j := 0; j < r; j++ {
+		for j := 0; j < c; j++ {
 			z1 := m1.At(i, j)
 			z2 := m2.At(i, j)
 			x1 := real(z1)
@@ -145,19 +355,27 @@ func ComplexMulElem(m1, m2 *mat.CDense) *mat.CDense {
 func (c *Config) InitState() {
 	// define the initial state of A
 	// fill random rectangles with random values
+	// the rectangle sizes and number follow the world size, so that any world gets at least one
+	r := c.random()
 	h, w := c.A.Dims()
+	// half sizes between 20 and 50 cells, down to an eighth and a quarter of small worlds
+	halfSize := func(length int) int {
+		low := min(20, length/8)
+		return randInt(r, low, max(low+1, min(50, length/4)))
+	}
 	// random number of rectagles according to window size
-	for k := 0; k < randInt(int(w/50), int(w/30)); k++ {
+	fewest := max(1, w/50)
+	for k := 0; k < randInt(r, fewest, max(fewest+1, w/30)); k++ {
 		// random widths
-		w1 := randInt(20, 50)
-		w2 := randInt(20, 50)
+		w1 := halfSize(h)
+		w2 := halfSize(w)
 		// center of rectangle position
-		x := randInt(w1, w-w1)
-		y := randInt(w2, h-w2)
+		x := randInt(r, w1, h-w1)
+		y := randInt(r, w2, w-w2)
 		// fill the rectangle to 1
 		for i := x - w1; i < x+w1; i++ {
 			for j := y - w2; j < y+w2; j++ {
-				c.A.Set(i, j, r0.Float64())
+				c.A.Set(i, j, r.Float64())
 			}
 		}
 	}
@@ -166,13 +384,149 @@ func (c *Config) InitState() {
 func (c *Config) InitStateFull() {
 	// define the initial state of A
 	// fill A with random values
+	r := c.random()
 	c.A.Apply(func(i, j int, v float64) float64 {
-		return r0.Float64()
+		return r.Float64()
 	}, c.A)
 }
 
-func NewConfig(h, w int, R, T, Mu, Sigma float64, Beta []float64) Config {
+func InitStateFractal(c *Config, octaves int, lacunarity, persistence float64) {
+	// define the initial state of A
+	// fill A with perlin noise summed over octaves: each octave has its frequency
+	// multiplied by lacunarity and its amplitude multiplied by persistence
+	h, w := c.A.Dims()
+	noises := make([]perlinNoise, octaves)
+	for o := range noises {
+		// the lattice period is rounded so that the noise wraps around the world
+		period := int(math.Round(4 * math.Pow(lacunarity, float64(o))))
+		noises[o] = newPerlinNoise(c.random(), period)
+	}
+	c.A.Apply(func(i, j int, _ float64) float64 {
+		sum := 0.
+		amplitude := 1.
+		for _, n := range noises {
+			sum += amplitude * n.At(float64(i)/float64(h), float64(j)/float64(w))
+			amplitude *= persistence
+		}
+		return sum
+	}, c.A)
+	// rescale between 0 and 1
+	data := c.A.RawMatrix().Data
+	min, max := floats.Min(data), floats.Max(data)
+	if max > min {
+		c.A.Apply(func(_, _ int, v float64) float64 {
+			return (v - min) / (max - min)
+		}, c.A)
+	}
+}
+
+func InitStateVoronoi(c *Config, nSeeds int) error {
+	// define the initial state of A
+	// place nSeeds random points and give each cell a gaussian falloff of its distance to the nearest one
+	// the falloff width follows the mean spacing between points, the world wraps around
+	// A is left unchanged if there is no point
+	if nSeeds <= 0 {
+		return fmt.Errorf("the voronoi initial state needs at least one point, got %d", nSeeds)
+	}
+	r := c.random()
+	h, w := c.A.Dims()
+	seeds := make([][2]float64, nSeeds)
+	for k := range seeds {
+		seeds[k] = [2]float64{r.Float64() * float64(h), r.Float64() * float64(w)}
+	}
+	spacing := math.Sqrt(float64(h*w) / float64(nSeeds))
+	s := 2 * math.Pow(spacing/4, 2)
+	c.A.Apply(func(i, j int, _ float64) float64 {
+		nearest := math.Inf(1)
+		for _, p := range seeds {
+			di := math.Abs(float64(i) - p[0])
+			dj := math.Abs(float64(j) - p[1])
+			di = math.Min(di, float64(h)-di)
+			dj = math.Min(dj, float64(w)-dj)
+			nearest = math.Min(nearest, di*di+dj*dj)
+		}
+		return math.Exp(-nearest / s)
+	}, c.A)
+	return nil
+}
+
+func InitStateGaussianMixture(c *Config, nComponents int, covarianceScale float64) {
+	// define the initial state of A
+	// sum of nComponents gaussian blobs at random positions, each with a random orientation
+	// and standard deviations along its axes between 0.5 and 1.5 times covarianceScale (in cells)
+	// the world wraps around and the values are clipped to 1
+	r := c.random()
+	h, w := c.A.Dims()
+	c.A.Zero()
+	for k := 0; k < nComponents; k++ {
+		ci, cj := r.Float64()*float64(h), r.Float64()*float64(w)
+		angle := r.Float64() * math.Pi
+		cos, sin := math.Cos(angle), math.Sin(angle)
+		s1 := covarianceScale * (0.5 + r.Float64())
+		s2 := covarianceScale * (0.5 + r.Float64())
+		amplitude := 0.5 + 0.5*r.Float64()
+		// only the cells within 3 standard deviations get a visible contribution
+		extent := int(math.Ceil(3 * math.Max(s1, s2)))
+		for di := -extent; di <= extent; di++ {
+			for dj := -extent; dj <= extent; dj++ {
+				i, j := int(ci)+di, int(cj)+dj
+				x, y := float64(i)-ci, float64(j)-cj
+				// coordinates along the axes of the blob
+				u, v := x*cos+y*sin, -x*sin+y*cos
+				g := amplitude * math.Exp(-(u*u/(s1*s1)+v*v/(s2*s2))/2)
+				i, j = mod(i, h), mod(j, w)
+				c.A.Set(i, j, c.A.At(i, j)+g)
+			}
+		}
+	}
+	c.A.Apply(func(_, _ int, v float64) float64 {
+		return Clip(v, 0, 1)
+	}, c.A)
+}
+
+func RandomizeParams(c *Config, rng *rand.Rand, muRange, sigmaRange [2]float64, betaRange [2]float64, nBeta int) error {
+	// draw Mu, Sigma and Beta (with 1 to nBeta rings) uniformly in their ranges
+	// then compute the new kernel and restart from a new initial state
+	// the config is unchanged if nBeta is below 1
+	if nBeta < 1 {
+		return fmt.Errorf("random parameters need at least one beta value, got %d", nBeta)
+	}
+	uniform := func(bounds [2]float64) float64 {
+		return bounds[0] + rng.Float64()*(bounds[1]-bounds[0])
+	}
+	c.Mu = uniform(muRange)
+	c.Sigma = uniform(sigmaRange)
+	c.Beta = make([]float64, randInt(rng, 1, nBeta+1))
+	for k := range c.Beta {
+		c.Beta[k] = uniform(betaRange)
+	}
+	c.ComputeKernel()
+	c.A.Zero()
+	c.InitState()
+	c.Step = 0
+	c.ClearHistory()
+	return nil
+}
+
+func (c *Config) Reset() {
+	// empty the world, keeping the parameters and the kernel
+	// A is replaced rather than zeroed as the history keeps the previous matrices
+	h, w := c.A.Dims()
+	c.A = mat.NewDense(h, w, nil)
+	c.Step = 0
+	c.ClearHistory()
+}
+
+func (c *Config) Invert() {
+	// replace each value v of A by 1-v
+	c.A.Apply(func(_, _ int, v float64) float64 {
+		return 1 - v
+	}, c.A)
+}
+
+func NewConfig(h, w int, R, T, Mu, Sigma float64, Beta []float64) (Config, error) {
 	// create a new config with all variables initialized
+	// invalid parameters give a *ConfigError listing them (see ValidateConfig)
 	setup := Config{
 		A:     mat.NewDense(h, w, nil),
 		T:     T,
@@ -180,6 +534,14 @@ func NewConfig(h, w int, R, T, Mu, Sigma float64, Beta []float64) Config {
 		Mu:    Mu,
 		Sigma: Sigma,
 		Beta:  Beta,
+		Seed:  time.Now().UnixNano(),
+
+		ClipSteepness: DefaultClipSteepness,
+		FFTPadFactor:  1,
+		KernelAspect:  1,
+	}
+	if err := ValidateConfig(&setup); err != nil {
+		return Config{}, err
 	}
 	// additional parameters
 	setup.Dx = float64(1 / R)
@@ -188,7 +550,7 @@ func NewConfig(h, w int, R, T, Mu, Sigma float64, Beta []float64) Config {
 	setup.ComputeKernel()
 	// initialize A
 	setup.InitState()
-	return setup
+	return setup, nil
 }
 
 func getRadiusMatrix(R int) *mat.Dense {
@@ -203,6 +565,61 @@ func getRadiusMatrix(R int) *mat.Dense {
 	return m
 }
 
+func getHexRadiusMatrix(R int) *mat.Dense {
+	// set the value of each pixel to be its hex grid distance to the center of the matrix
+	// the matrix is in axial coordinates (q, r) = (j, i), the cube coordinates being (q, -q-r, r)
+	// and the distance the largest of the absolute cube coordinates
+	m := mat.NewDense(2*R+1, 2*R+1, nil)
+	for i := -R; i <= R; i++ {
+		for j := -R; j <= R; j++ {
+			x, y, z := float64(j), float64(-j-i), float64(i)
+			m.Set(R+i, R+j, math.Max(math.Abs(x), math.Max(math.Abs(y), math.Abs(z))))
+		}
+	}
+	return m
+}
+
+func getEllipticalRadiusMatrix(R int, aspectRatio, angle float64) *mat.Dense {
+	// set the value of each pixel to be an elliptical distance to the center of the matrix
+	// the major axis of length R is rotated by angle and the minor one is R/aspectRatio long
+	// an aspectRatio below 1 swaps the axes
+	sx, sy := 1., aspectRatio
+	if aspectRatio < 1 {
+		sx, sy = 1/aspectRatio, 1
+	}
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	m := mat.NewDense(2*R+1, 2*R+1, nil)
+	for i := -R; i <= R; i++ {
+		for j := -R; j <= R; j++ {
+			u := float64(i)*cos + float64(j)*sin
+			v := -float64(i)*sin + float64(j)*cos
+			m.Set(R+i, R+j, math.Hypot(sx*u, sy*v))
+		}
+	}
+	return m
+}
+
+// distances towards the bias angle are stretched by 1 + kernelBiasStrength
+const kernelBiasStrength = 0.5
+
+func biasRadiusMatrix(m *mat.Dense, angle float64) {
+	// stretch the distances of a radius matrix towards angle, smoothly from 1 behind the center
+	// to 1+kernelBiasStrength in front of it: the forward neighbors get a weaker influence
+	// (the kernel is shorter on this side) which breaks the isotropy of the kernel
+	k, _ := m.Dims()
+	R := (k - 1) / 2
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	m.Apply(func(i, j int, v float64) float64 {
+		di, dj := float64(i-R), float64(j-R)
+		d := math.Hypot(di, dj)
+		if d == 0 {
+			return v
+		}
+		forward := (di*cos + dj*sin) / d
+		return v * (1 + kernelBiasStrength*(1+forward)/2)
+	}, m)
+}
+
 func KernelCorePoly(r float64) float64 {
 	// kernel core function, polynomial
 	var a float64 = 4
@@ -219,32 +636,101 @@ func KernelCoreExp(r float64) float64 {
 
 func (c *Config) ComputeKernel() {
 	// compute the kernel and its fourier transform
+	// dx follows R so the kernel is never computed with a stale value
+	c.Dx = 1 / c.R
+	K, KFFT := c.newKernel()
+	c.setKernel(K, KFFT)
+}
+
+func (c *Config) newKernel() (*mat.Dense, *mat.CDense) {
+	// compute the kernel of the current parameters and its fourier transform, without changing the config
 	// cf. https://arxiv.org/pdf/1812.05433.pdf section 2.2.1
+	dx := 1 / c.R
 	// get radius matrix and scale it by dx and the size of beta
-	K := getRadiusMatrix(int(c.R))
+	var K *mat.Dense
+	if c.GridType == GridHex {
+		K = getHexRadiusMatrix(int(c.R))
+	} else if c.KernelAspect == 0 || c.KernelAspect == 1 {
+		K = getRadiusMatrix(int(c.R))
+	} else {
+		K = getEllipticalRadiusMatrix(int(c.R), c.KernelAspect, c.KernelAngle)
+	}
+	if c.UseAsymmetricKernel {
+		biasRadiusMatrix(K, c.KernelAngleBias)
+	}
 	lenBeta := float64(len(c.Beta))
-	lenBetaDx := lenBeta * c.Dx
+	lenBetaDx := lenBeta * dx
 	K.Scale(lenBetaDx, K)
-	// compute kernel shell, based on kernel core repeated in concentric rings for each element of beta
 	K.Apply(func(_, _ int, v float64) float64 {
-		// distance to the center over lenBeta is ignored (no beta element for these indexes)
-		if v >= lenBeta {
-			return 0
-		}
-		return c.Beta[int(math.Floor(v))] * KernelCoreExp(math.Mod(v, 1))
+		return c.kernelShell(v)
 	}, K)
 	// normalize kernel
 	sumK := 1 / floats.Sum(K.RawMatrix().Data)
 	K.Scale(sumK, K)
 	// compute FFT
 	rows, cols := c.A.Dims()
-	c.KFFT = FFT(FFTShift(K, rows, cols))
+	return K, HalfFFT(FFTShift(K, rows, cols))
+}
+
+func (c *Config) kernelShell(v float64) float64 {
+	// kernel shell, based on kernel core repeated in concentric rings for each element of beta
+	// v is the distance to the center scaled so that each ring is 1 wide
+	// distance to the center over the number of rings is ignored (no beta element for these indexes)
+	if v >= float64(len(c.Beta)) {
+		return 0
+	}
+	core := KernelCoreExp
+	if c.KernelCore == KernelPoly {
+		core = KernelCorePoly
+	}
+	return c.Beta[int(math.Floor(v))] * core(math.Mod(v, 1))
+}
+
+func (c *Config) setKernel(K *mat.Dense, KFFT *mat.CDense) {
+	// use a new kernel, the FFTs derived from the previous one are dropped
+	c.KFFT = KFFT
+	c.padKFFT = nil
+	c.factorKFFT = nil
+	c.kernelVersion++
 	// update the kernel in the config
 	c.Kernel = mat.DenseCopyOf(K)
+	c.KernelSupportRadius = supportRadius(c.Kernel)
+}
+
+func (c *Config) kernelRadius() int {
+	// radius of the current kernel, which can lag behind R while a new kernel is computed
+	k, _ := c.Kernel.Dims()
+	return (k - 1) / 2
+}
+
+func (c *Config) directConvolution() bool {
+	// whether the kernel is small enough for the direct convolution to beat the FFT, both absolutely
+	// and compared to the world: the whole kernel matrix is convolved, even where its mass is negligible
+	h, w := c.A.Dims()
+	return float64(c.kernelRadius()) < math.Min(directConvolutionRadius, math.Sqrt(float64(h*w))/4)
+}
+
+func (c *Config) growthParameters(i, j int) (mu, sigma float64) {
+	// Mu and Sigma at a cell, from the maps if they are set
+	mu, sigma = c.Mu, c.Sigma
+	if c.MuMap != nil {
+		mu = c.MuMap.At(i, j)
+	}
+	if c.SigmaMap != nil {
+		sigma = c.SigmaMap.At(i, j)
+	}
+	return mu, sigma
 }
 
 func (c *Config) GrowthMapping(U *mat.Dense) *mat.Dense {
 	// growth mapping function, exponential
+	if c.MuMap != nil || c.SigmaMap != nil {
+		U.Apply(func(i, j int, v float64) float64 {
+			mu, sigma := c.growthParameters(i, j)
+			return 2*math.Exp(-1*math.Pow(v-mu, 2)/(2*sigma*sigma)) - 1
+		}, U)
+		return U
+	}
 	s := (2 * math.Pow(c.Sigma, 2))
 	U.Apply(func(_, _ int, v float64) float64 {
 		return 2*math.Exp(-1*math.Pow(v-c.Mu, 2)/s) - 1
@@ -252,33 +738,158 @@ func (c *Config) GrowthMapping(U *mat.Dense) *mat.Dense {
 	return U
 }
 
-func (c *Config) Update() {
-	// compute the next state
-	//start := time.Now()
-	var U *mat.Dense
+func fastExp(x float64) float64 {
+	// Schraudolph approximation of exp, writing the exponent bits of a float64 directly
+	// relative error is a few percent
+	if x < -700 {
+		return 0
+	} else if x > 700 {
+		return math.Inf(1)
+	}
+	return math.Float64frombits(uint64(int64(1512775*x+1072632447)) << 32)
+}
+
+func (c *Config) GrowthMappingFast(U *mat.Dense) *mat.Dense {
+	// growth mapping function, exponential approximated with fastExp
+	if c.MuMap != nil || c.SigmaMap != nil {
+		U.Apply(func(i, j int, v float64) float64 {
+			mu, sigma := c.growthParameters(i, j)
+			d := v - mu
+			return 2*fastExp(-d*d/(2*sigma*sigma)) - 1
+		}, U)
+		return U
+	}
+	s := (2 * c.Sigma * c.Sigma)
+	U.Apply(func(_, _ int, v float64) float64 {
+		d := v - c.Mu
+		return 2*fastExp(-d*d/s) - 1
+	}, U)
+	return U
+}
+
+func (c *Config) Potential() *mat.Dense {
 	// compute U, the potential
-	// if size of world is small (for now always off)
-	if false {
-		// convolution approach
-		U = convolve(c.A, c.Kernel)
+	var U *mat.Dense
+	if c.Boundary != BoundaryTorus {
+		return c.boundedPotential()
+	}
+	// for small kernels the direct convolution is faster than the FFT
+	if c.directConvolution() {
+		// convolution approach, the world wraps around through the padding
+		// unless FFTPadFactor asks for a world without wrap around: it is zero-padded then,
+		// which gives the same potential as the padded FFT
+		padded := wrapPadMatrix(c.A, c.kernelRadius())
+		if c.FFTPadFactor > 1 {
+			padded = padMatrix(c.A, c.kernelRadius())
+		}
+		U = convolvePadded(padded, c.Kernel, runtime.NumCPU())
+	} else if c.FFTPadFactor > 1 {
+		// FFT approach on a zero-padded state, without wrapping around
+		U = c.factorPotential()
 	} else {
 		// FFT approach
-		AFFT := FFT(c.A)
-		U = RealPart(IFFT(ComplexMulElem(c.KFFT, AFFT)))
+		// the state is real, so half of the spectrum is enough
+		h, _ := c.A.Dims()
+		U = HalfIFFT(ComplexMulElem(c.KFFT, HalfFFT(c.A)), h)
 	}
+	return U
+}
+
+func (c *Config) factorPotential() *mat.Dense {
+	// compute the potential with the state zero-padded to FFTPadFactor times its size
+	// then crop the result back to the state size
+	h, w := c.A.Dims()
+	ph, pw := c.FFTPadFactor*h, c.FFTPadFactor*w
+	padded := mat.NewDense(ph, pw, nil)
+	padded.Slice(0, h, 0, w).(*mat.Dense).Copy(c.A)
+	// the kernel FFT at the padded size is kept until the kernel or the factor changes
+	if c.factorKFFT == nil || c.kfftFactor != c.FFTPadFactor {
+		c.factorKFFT = HalfFFT(FFTShift(c.Kernel, ph, pw))
+		c.kfftFactor = c.FFTPadFactor
+	}
+	U := HalfIFFT(ComplexMulElem(c.factorKFFT, HalfFFT(padded)), ph)
+	return mat.DenseCopyOf(U.Slice(0, h, 0, w))
+}
+
+func (c *Config) Grow(U *mat.Dense) {
+	// update the state from the potential U
 	// Apply growth scaled by dt
-	G := c.GrowthMapping(U)
+	var G *mat.Dense
+	if c.FastMath {
+		G = c.GrowthMappingFast(U)
+	} else {
+		G = c.GrowthMapping(U)
+	}
 	G.Scale(c.Dt, G)
 	A := mat.DenseCopyOf(c.A)
 	A.Add(A, G)
 	// clip values
 	A.Apply(func(_, _ int, v float64) float64 {
-		return Clip(v, 0, 1)
+		return c.clip(v)
 	}, A)
 	// update the state in the config
 	c.A = mat.DenseCopyOf(A)
-	//elapsed := time.Since(start)
-	//fmt.Println("time elapsed:", elapsed)
+}
+
+func (c *Config) Update() {
+	// compute the next state
+	start := time.Now()
+	if c.HistoryDepth > 0 {
+		c.pushHistory()
+	}
+	c.applyOffset()
+	prev := c.A
+	c.Grow(c.Potential())
+	c.applyMask()
+	c.Energy = KineticEnergy(prev, c.A)
+	c.Step++
+	c.Events.Publish(Event{Type: EventStep, Step: c.Step, Config: c, Elapsed: time.Since(start)})
+	if slices.Contains(c.Breakpoints, c.Step) {
+		c.Events.Publish(Event{Type: EventBreakpoint, Step: c.Step, Config: c})
+	}
+}
+
+func (c *Config) applyMask() {
+	// zero the cells outside of the mask
+	if c.Mask == nil {
+		return
+	}
+	c.A.Apply(func(i, j int, v float64) float64 {
+		if c.Mask.At(i, j) < 0.5 {
+			return 0
+		}
+		return v
+	}, c.A)
+}
+
+func (c *Config) applyOffset() {
+	// translate A (and the spatial maps) by the offset change since the last update
+	// the world scrolls without changing the physics when it wraps around
+	dx, dy := c.OffsetX-c.offsetX, c.OffsetY-c.offsetY
+	if dx == 0 && dy == 0 {
+		return
+	}
+	c.A = cyclicShift(c.A, dx, dy)
+	if c.MuMap != nil {
+		c.MuMap = cyclicShift(c.MuMap, dx, dy)
+	}
+	if c.SigmaMap != nil {
+		c.SigmaMap = cyclicShift(c.SigmaMap, dx, dy)
+	}
+	if c.Mask != nil {
+		c.Mask = cyclicShift(c.Mask, dx, dy)
+	}
+	c.offsetX, c.offsetY = c.OffsetX, c.OffsetY
+}
+
+func cyclicShift(m *mat.Dense, di, dj int) *mat.Dense {
+	// move each value of a matrix by (di, dj), wrapping around the edges
+	r, c := m.Dims()
+	shifted := mat.NewDense(r, c, nil)
+	shifted.Apply(func(i, j int, _ float64) float64 {
+		return m.At(mod(i-di, r), mod(j-dj, c))
+	}, shifted)
+	return shifted
 }
 
 func padMatrix(m *mat.Dense, padding int) *mat.Dense {
@@ -290,37 +901,93 @@ func padMatrix(m *mat.Dense, padding int) *mat.Dense {
 	padded := mat.NewDense(nh, nw, nil)
 	// copy matrix at the center
 	for i := 0; i < h; i++ {
-		for j := 0; j < h; j++ {
+		for j := 0; j < w; j++ {
 			padded.Set(i+padding, j+padding, m.At(i, j))
 		}
 	}
 	return padded
 }
 
+func wrapPadMatrix(m *mat.Dense, padding int) *mat.Dense {
+	// add padding around a matrix filled with the opposite side, as the world wraps around
+	h, w := m.Dims()
+	padded := mat.NewDense(h+2*padding, w+2*padding, nil)
+	padded.Apply(func(i, j int, _ float64) float64 {
+		return m.At(mod(i-padding, h), mod(j-padding, w))
+	}, padded)
+	return padded
+}
+
 func convolve(m, kernel *mat.Dense) *mat.Dense {
-	// perform a convolution between a matrix and a kernel matrix
+	// perform a convolution between a matrix and a kernel matrix, values outside the matrix are zeros
 	p, _ := kernel.Dims()
 	p = int((p - 1) / 2)
-	h, w := m.Dims()
-	// n will receive the new computed values and ref is a copy of n before it is altered
-	n := padMatrix(m, p)
-	ref := mat.DenseCopyOf(n)
-	n.Apply(func(i, j int, _ float64) float64 {
-		// first flip the kernel, no need here as it is symmetrical
-		// do not compute for padded values
-		if i < p || i >= h+p || j < p || j >= w+p {
-			return 0
-		} else {
-			// take a submatrix of n, same size as kernel
-			subm := mat.DenseCopyOf(ref.Slice(i-p, i+p+1, j-p, j+p+1))
-			// multiply element wise with kernel
-			subm.MulElem(subm, kernel)
-			// sum all elements
-			sum := floats.Sum(subm.RawMatrix().Data)
-			return sum
+	return convolvePadded(padMatrix(m, p), kernel, runtime.NumCPU())
+}
+
+func convolvePadded(padded, kernel *mat.Dense, workers int) *mat.Dense {
+	// convolution of a matrix already padded with the kernel radius, the result has the size of the unpadded matrix
+	// rows are split in bands computed by workers goroutines (1 for a single-threaded convolution)
+	// the kernel is flipped so that asymmetric kernels move the same way as with the FFT
+	k, _ := kernel.Dims()
+	p := int((k - 1) / 2)
+	ph, pw := padded.Dims()
+	h, w := ph-2*p, pw-2*p
+	result := mat.NewDense(h, w, nil)
+	src := padded.RawMatrix()
+	ker := mat.NewDense(k, k, nil)
+	ker.Apply(func(i, j int, _ float64) float64 {
+		return kernel.At(k-1-i, k-1-j)
+	}, ker)
+	flipped := ker.RawMatrix()
+	dst := result.RawMatrix()
+	if workers < 1 {
+		workers = 1
+	}
+	band := (h + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < h; start += band {
+		end := start + band
+		if end > h {
+			end = h
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			// each band writes its own rows of the result
+			for i := start; i < end; i++ {
+				for j := 0; j < w; j++ {
+					sum := 0.
+					for a := 0; a < k; a++ {
+						row := src.Data[(i+a)*src.Stride+j : (i+a)*src.Stride+j+k]
+						sum += floats.Dot(row, flipped.Data[a*flipped.Stride:a*flipped.Stride+k])
+					}
+					dst.Data[i*dst.Stride+j] = sum
+				}
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	return result
+}
+
+func InvertGrowthMapping(G *mat.Dense, mu, sigma float64) (ascending, descending *mat.Dense, err error) {
+	// potential values u such that the exponential growth mapping gives G(u) = g, for each g of G
+	// the gaussian bump has two solutions: ascending below mu and descending above mu
+	// g = -1 is only reached at infinity so it gives -Inf and +Inf
+	r, c := G.Dims()
+	ascending = mat.NewDense(r, c, nil)
+	descending = mat.NewDense(r, c, nil)
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			g := G.At(i, j)
+			if math.Abs(g) > 1 {
+				return nil, nil, fmt.Errorf("growth value %v at (%d, %d) out of [-1, 1]", g, i, j)
+			}
+			d := sigma * math.Sqrt(-2*math.Log((g+1)/2))
+			ascending.Set(i, j, mu-d)
+			descending.Set(i, j, mu+d)
 		}
-	},
-		n)
-	// remove padding
-	return mat.DenseCopyOf(n.Slice(p, h+p, p, w+p))
+	}
+	return ascending, descending, nil
 }
@@ -0,0 +1,322 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func newTestConfig(t testing.TB, size int, seed int64) Config {
+	// orbium-like config on a square world with a seeded initial state
+	t.Helper()
+	c, err := Params{Width: size, Height: size, R: 13, T: 10, Mu: 0.15, Sigma: 0.015, Beta: []float64{1}}.NewConfig(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestKernelCoreEquivalence(t *testing.T) {
+	// the exp and poly cores give close but different trajectories, both bounded in [0,1]
+	exp := newTestConfig(t, 128, 1)
+	poly := exp.Clone()
+	poly.KernelCore = KernelPoly
+	poly.ComputeKernel()
+	for step := 0; step < 50; step++ {
+		exp.Update()
+		poly.Update()
+		for _, c := range []*Config{&exp, &poly} {
+			for _, v := range c.A.RawMatrix().Data {
+				if v < 0 || v > 1 {
+					t.Fatalf("step %d: value %g out of [0,1] with core %d", step, v, c.KernelCore)
+				}
+			}
+		}
+	}
+	// the states are compared alone, the configs differ by their core anyway
+	if mat.EqualApprox(exp.A, poly.A, 1e-6) {
+		t.Fatal("the exp and poly cores give the same trajectory")
+	}
+}
+
+func fftPotential(c *Config) *mat.Dense {
+	// potential of the torus through the FFT, whatever the kernel size
+	h, _ := c.A.Dims()
+	return HalfIFFT(ComplexMulElem(c.KFFT, HalfFFT(c.A)), h)
+}
+
+func directPotential(c *Config) *mat.Dense {
+	// potential of the torus through the direct convolution, whatever the kernel size
+	return convolvePadded(wrapPadMatrix(c.A, c.kernelRadius()), c.Kernel, 1)
+}
+
+func TestAsymmetricKernelDirection(t *testing.T) {
+	// a biased kernel gives the same potential through the direct convolution and the FFT
+	c := newTestConfig(t, 128, 1)
+	c.UseAsymmetricKernel = true
+	c.KernelAngleBias = 1
+	c.ComputeKernel()
+	k, _ := c.Kernel.Dims()
+	rotated := mat.NewDense(k, k, nil)
+	rotated.Apply(func(i, j int, _ float64) float64 {
+		return c.Kernel.At(k-1-i, k-1-j)
+	}, rotated)
+	if mat.EqualApprox(c.Kernel, rotated, 1e-9) {
+		t.Fatal("the biased kernel is centrosymmetric")
+	}
+	if direct, fft := directPotential(&c), fftPotential(&c); !mat.EqualApprox(direct, fft, 1e-9) {
+		t.Fatal("the direct convolution and the FFT give different potentials")
+	}
+}
+
+func TestDirectConvolutionChoice(t *testing.T) {
+	// the path follows the size of the kernel matrix, not the radius holding its mass
+	small, err := NewConfig(128, 128, 10, 10, 0.15, 0.015, []float64{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !small.directConvolution() {
+		t.Error("a kernel of radius 10 is not convolved directly")
+	}
+	// the mass of this kernel is in its first ring, well inside R
+	large, err := NewConfig(512, 512, 80, 10, 0.15, 0.015, []float64{1, 0, 0, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if large.KernelSupportRadius >= directConvolutionRadius {
+		t.Fatalf("support radius %g, the test needs it below %d", large.KernelSupportRadius, directConvolutionRadius)
+	}
+	if large.directConvolution() {
+		t.Error("a kernel of radius 80 is convolved directly")
+	}
+}
+
+func TestNonPowerOfTwoWorld(t *testing.T) {
+	// on a 300x300 torus, the FFT potential matches the direct convolution
+	c, err := Params{Width: 300, Height: 300, R: 30, T: 10, Mu: 0.15, Sigma: 0.015, Beta: []float64{1, 0.5}}.NewConfig(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.directConvolution() {
+		t.Fatal("the test needs the FFT path")
+	}
+	if direct, fft := directPotential(&c), c.Potential(); !mat.EqualApprox(direct, fft, 1e-9) {
+		t.Fatal("the FFT potential differs from the direct convolution")
+	}
+	for step := 0; step < 10; step++ {
+		c.Update()
+	}
+	if direct, fft := directPotential(&c), c.Potential(); !mat.EqualApprox(direct, fft, 1e-9) {
+		t.Fatal("the FFT potential differs from the direct convolution after 10 steps")
+	}
+}
+
+func BenchmarkFFTPotential(b *testing.B) {
+	// cost of the FFT potential on power of two and other world sizes
+	for _, size := range []int{256, 300, 512} {
+		b.Run(fmt.Sprintf("%dx%d", size, size), func(b *testing.B) {
+			c := newTestConfig(b, size, 1)
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				fftPotential(&c)
+			}
+		})
+	}
+}
+
+func BenchmarkGrowthMapping(b *testing.B) {
+	// exact and fast growth mappings on several world sizes, the fast one reports its largest error
+	for _, size := range []int{128, 256, 512} {
+		c := newTestConfig(b, size, 1)
+		potential := c.Potential()
+		exact := c.GrowthMapping(mat.DenseCopyOf(potential))
+		for _, fast := range []bool{false, true} {
+			name := fmt.Sprintf("exact/%dx%d", size, size)
+			mapping := c.GrowthMapping
+			if fast {
+				name = fmt.Sprintf("fast/%dx%d", size, size)
+				mapping = c.GrowthMappingFast
+			}
+			b.Run(name, func(b *testing.B) {
+				U := mat.NewDense(size, size, nil)
+				for n := 0; n < b.N; n++ {
+					U.Copy(potential)
+					mapping(U)
+				}
+				maxError := 0.
+				for k, v := range U.RawMatrix().Data {
+					maxError = math.Max(maxError, math.Abs(v-exact.RawMatrix().Data[k]))
+				}
+				b.ReportMetric(maxError, "max-error")
+			})
+		}
+	}
+}
+
+func TestConvolutionPaths(t *testing.T) {
+	// the direct convolution, single-threaded or not, gives the potential of the FFT
+	for _, beta := range [][]float64{{1}, {1, 0.5}, {0.3, 1, 0.2}} {
+		c, err := Params{Width: 128, Height: 128, R: 13, T: 10, Mu: 0.15, Sigma: 0.015, Beta: beta}.NewConfig(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		padded := wrapPadMatrix(c.A, c.kernelRadius())
+		fft := fftPotential(&c)
+		for _, workers := range []int{1, 4} {
+			if direct := convolvePadded(padded, c.Kernel, workers); !mat.EqualApprox(direct, fft, 1e-9) {
+				t.Errorf("beta %v, %d workers: the direct convolution differs from the FFT", beta, workers)
+			}
+		}
+	}
+}
+
+func BenchmarkConvolution(b *testing.B) {
+	// single-threaded and parallel direct convolutions against the FFT for a kernel of radius 13
+	for _, size := range []int{128, 256} {
+		c := newTestConfig(b, size, 1)
+		padded := wrapPadMatrix(c.A, c.kernelRadius())
+		b.Run(fmt.Sprintf("single/%dx%d", size, size), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				convolvePadded(padded, c.Kernel, 1)
+			}
+		})
+		b.Run(fmt.Sprintf("parallel/%dx%d", size, size), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				convolvePadded(padded, c.Kernel, runtime.NumCPU())
+			}
+		})
+		b.Run(fmt.Sprintf("fft/%dx%d", size, size), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				fftPotential(&c)
+			}
+		})
+	}
+}
+
+func TestHexKernelSymmetry(t *testing.T) {
+	// the hex kernel is invariant by a sixth of a turn on the hex grid, not by a quarter turn of the matrix
+	c := newTestConfig(t, 128, 1)
+	c.GridType = GridHex
+	c.ComputeKernel()
+	k, _ := c.Kernel.Dims()
+	R := (k - 1) / 2
+	at := func(i, j int) float64 {
+		// kernel value at the axial coordinates (q, r) = (j, i), 0 outside the matrix
+		if i < -R || i > R || j < -R || j > R {
+			return 0
+		}
+		return c.Kernel.At(R+i, R+j)
+	}
+	sixth, quarter := 0., 0.
+	for i := -R; i <= R; i++ {
+		for j := -R; j <= R; j++ {
+			// (q, r) -> (-r, q+r) turns by 60 degrees on the hex grid
+			sixth = math.Max(sixth, math.Abs(at(i, j)-at(i+j, -i)))
+			// (i, j) -> (j, -i) turns the matrix by 90 degrees
+			quarter = math.Max(quarter, math.Abs(at(i, j)-at(j, -i)))
+		}
+	}
+	if sixth > 1e-12 {
+		t.Errorf("the hex kernel changes by up to %g with a sixth of a turn", sixth)
+	}
+	if quarter < 1e-3*mat.Max(c.Kernel) {
+		t.Errorf("the hex kernel is invariant by a quarter turn (difference %g)", quarter)
+	}
+	c.KernelAspect = 2
+	if ValidateConfig(&c) == nil {
+		t.Error("a stretched hex kernel is accepted")
+	}
+}
+
+func TestVoronoiSeeds(t *testing.T) {
+	// no point is an error, one point gives a state in [0,1]
+	c := newTestConfig(t, 128, 1)
+	c.A.Zero()
+	for _, n := range []int{0, -1} {
+		if err := InitStateVoronoi(&c, n); err == nil {
+			t.Fatalf("%d points accepted", n)
+		}
+	}
+	if mat.Max(c.A) != 0 {
+		t.Fatal("the state is changed by an invalid number of points")
+	}
+	if err := InitStateVoronoi(&c, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range c.A.RawMatrix().Data {
+		if !(v >= 0 && v <= 1) {
+			t.Fatalf("value %g out of [0,1]", v)
+		}
+	}
+}
+
+func TestRandomizeParamsBetaLength(t *testing.T) {
+	// fewer than one beta value is an error and leaves the config unchanged
+	c := newTestConfig(t, 128, 1)
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, -1} {
+		if err := RandomizeParams(&c, rng, [2]float64{0.1, 0.2}, [2]float64{0.01, 0.02}, [2]float64{0, 1}, n); err == nil {
+			t.Fatalf("%d beta values accepted", n)
+		}
+	}
+	if c.Mu != 0.15 || len(c.Beta) != 1 {
+		t.Fatalf("config changed: mu %g beta %v", c.Mu, c.Beta)
+	}
+	if err := RandomizeParams(&c, rng, [2]float64{0.1, 0.2}, [2]float64{0.01, 0.02}, [2]float64{0.5, 1}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Beta) != 1 {
+		t.Fatalf("beta %v, want one value", c.Beta)
+	}
+}
+
+func TestInitStateWorldSizes(t *testing.T) {
+	// small and non-square worlds accepted by the validation get a state with at least one rectangle
+	for _, size := range [][2]int{{28, 28}, {64, 64}, {80, 80}, {512, 256}, {256, 512}, {40, 300}} {
+		p := Params{Width: size[1], Height: size[0], R: 13, T: 10, Mu: 0.15, Sigma: 0.015, Beta: []float64{1}}
+		for seed := int64(0); seed < 5; seed++ {
+			c, err := p.NewConfig(seed)
+			if err != nil {
+				t.Fatalf("%dx%d: %v", size[0], size[1], err)
+			}
+			if h, w := c.A.Dims(); h != size[0] || w != size[1] {
+				t.Fatalf("%dx%d: state of %dx%d", size[0], size[1], h, w)
+			}
+			if mat.Max(c.A) == 0 {
+				t.Fatalf("%dx%d, seed %d: empty state", size[0], size[1], seed)
+			}
+		}
+	}
+}
+
+func TestPaddedDirectPotential(t *testing.T) {
+	// with a small kernel and FFT padding, the direct potential does not wrap around:
+	// it matches the padded FFT and differs from the torus near the edge
+	c := newTestConfig(t, 128, 1)
+	if !c.directConvolution() {
+		t.Fatal("the test kernel is not convolved directly")
+	}
+	// a blob on the left edge, whose potential wraps to the right edge on the torus
+	c.A.Zero()
+	for i := 60; i < 68; i++ {
+		for j := 0; j < 4; j++ {
+			c.A.Set(i, j, 1)
+		}
+	}
+	wrapped := c.Potential()
+	c.FFTPadFactor = 2
+	padded := c.Potential()
+	if !denseWithin(padded, c.factorPotential(), 1e-9) {
+		t.Fatal("the padded direct potential differs from the padded FFT one")
+	}
+	if wrapped.At(64, 127) == 0 {
+		t.Fatal("the torus potential does not wrap around")
+	}
+	if v := padded.At(64, 127); math.Abs(v) > 1e-12 {
+		t.Fatalf("the padded potential wraps around: %g at the right edge", v)
+	}
+}
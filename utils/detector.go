@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"gonum.org/v1/gonum/stat"
+)
+
+// a change of regime of the simulation, its kind is EventSteady or EventDiverge
+type StateEvent struct {
+	Kind   string
+	Step   int
+	Energy float64
+}
+
+// watches the kinetic energy (mean squared change per step) averaged over the last steps
+// it becomes steady when the energy stays below Low for Consecutive steps
+// and oscillating again only once it rises above High (hysteresis)
+type SteadyStateDetector struct {
+	Low, High   float64
+	Consecutive int
+	energies    []float64
+	next, count int
+	below       int
+	steady      bool
+}
+
+type ManageSteadyStateDetector interface {
+	Observe()
+}
+
+func NewSteadyStateDetector(window, consecutive int, low, high float64) SteadyStateDetector {
+	// create a detector over a rolling window of steps
+	if window < 2 {
+		window = 2
+	}
+	return SteadyStateDetector{
+		Low:         low,
+		High:        high,
+		Consecutive: consecutive,
+		energies:    make([]float64, window),
+	}
+}
+
+func (d *SteadyStateDetector) Observe(c *Config) (StateEvent, bool) {
+	// record the kinetic energy of the last update and return an event if the regime changed
+	d.energies[d.next] = c.Energy
+	d.next = (d.next + 1) % len(d.energies)
+	if d.count < len(d.energies) {
+		d.count++
+		// wait for a full window
+		if d.count < len(d.energies) {
+			return StateEvent{}, false
+		}
+	}
+	energy := stat.Mean(d.energies, nil)
+	if !d.steady {
+		if energy < d.Low {
+			d.below++
+		} else {
+			d.below = 0
+		}
+		if d.below >= d.Consecutive {
+			d.steady = true
+			return StateEvent{Kind: EventSteady, Step: c.Step, Energy: energy}, true
+		}
+	} else if energy > d.High {
+		d.steady = false
+		d.below = 0
+		return StateEvent{Kind: EventDiverge, Step: c.Step, Energy: energy}, true
+	}
+	return StateEvent{}, false
+}
+
+// watches the mean of the state over the last steps and finds its period every Interval steps
+type OscillationDetector struct {
+	MaxPeriod, Interval int
+	means               []float64
+	next, count         int
+	period              int
+}
+
+type ManageOscillationDetector interface {
+	Observe()
+}
+
+func NewOscillationDetector(window, maxPeriod, interval int) OscillationDetector {
+	// create a detector over a rolling window of steps, it should hold a few periods
+	if interval < 1 {
+		interval = 1
+	}
+	return OscillationDetector{
+		MaxPeriod: maxPeriod,
+		Interval:  interval,
+		means:     make([]float64, window),
+	}
+}
+
+func (d *OscillationDetector) Observe(c *Config) (period int, changed bool) {
+	// record the mean of the state and return the period when it changed (0 when it stops oscillating)
+	d.means[d.next] = MeanState(c)
+	d.next = (d.next + 1) % len(d.means)
+	if d.count < len(d.means) {
+		d.count++
+		// wait for a full window
+		if d.count < len(d.means) {
+			return d.period, false
+		}
+	}
+	if c.Step%d.Interval != 0 {
+		return d.period, false
+	}
+	// the window in time order, the oldest mean is the next one overwritten
+	series := append(append([]float64(nil), d.means[d.next:]...), d.means[:d.next]...)
+	if period = OscillationPeriod(series, d.MaxPeriod); period == d.period {
+		return period, false
+	}
+	d.period = period
+	return period, true
+}
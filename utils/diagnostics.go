@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+// summary of a kernel to check its normalization and extent
+type KernelDiagnostics struct {
+	// sum of the values, 1 when normalized
+	Sum float64
+	Max float64
+	// radius of the disk holding 99% of the kernel mass
+	SupportRadius float64
+	// number of beta elements with a weight over 0.01
+	Rings int
+	// whether the potential is computed by direct convolution instead of FFT
+	Direct bool
+}
+
+func DiagnoseKernel(c *Config) KernelDiagnostics {
+	// compute the diagnostics of the config kernel
+	data := c.Kernel.RawMatrix().Data
+	d := KernelDiagnostics{
+		Sum:           floats.Sum(data),
+		Max:           mat.Max(c.Kernel),
+		SupportRadius: c.KernelSupportRadius,
+		Direct:        c.directConvolution(),
+	}
+	for _, b := range c.Beta {
+		if b > 0.01 {
+			d.Rings++
+		}
+	}
+	return d
+}
+
+func supportRadius(K *mat.Dense) float64 {
+	// radius of the disk holding 99% of the kernel mass
+	// accumulate the mass from the center outwards
+	size, _ := K.Dims()
+	center := (size - 1) / 2
+	type cell struct{ distance, value float64 }
+	cells := make([]cell, 0, size*size)
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			cells = append(cells, cell{math.Hypot(float64(i-center), float64(j-center)), K.At(i, j)})
+		}
+	}
+	sort.Slice(cells, func(a, b int) bool {
+		return cells[a].distance < cells[b].distance
+	})
+	total := floats.Sum(K.RawMatrix().Data)
+	mass := 0.
+	for _, k := range cells {
+		mass += k.value
+		if mass >= 0.99*total {
+			return k.distance
+		}
+	}
+	return float64(center)
+}
+
+func (d KernelDiagnostics) String() string {
+	// one line per diagnostic
+	convolution := "FFT"
+	if d.Direct {
+		convolution = "direct"
+	}
+	return fmt.Sprintf("sum: %.4f\nmax: %.4g\nsupport radius: %.1f\nrings: %d\nconvolution: %s", d.Sum, d.Max, d.SupportRadius, d.Rings, convolution)
+}
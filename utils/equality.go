@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"math"
+	"math/cmplx"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func (c *Config) Equal(other Config) bool {
+	// compare exactly the parameters and matrices of two configs
+	// the event bus is not compared
+	return c.ApproxEqual(other, 0)
+}
+
+func (c *Config) ApproxEqual(other Config, tol float64) bool {
+	// compare the parameters and matrices of two configs with an absolute tolerance
+	// the event bus is not compared
+	scalars := [][2]float64{
+		{c.R, other.R},
+		{c.T, other.T},
+		{c.Mu, other.Mu},
+		{c.Sigma, other.Sigma},
+		{c.Dx, other.Dx},
+		{c.Dt, other.Dt},
+		{c.ClipSteepness, other.ClipSteepness},
+		{c.KernelAspect, other.KernelAspect},
+		{c.KernelAngle, other.KernelAngle},
+		{c.KernelAngleBias, other.KernelAngleBias},
+	}
+	for _, s := range scalars {
+		if !within(s[0], s[1], tol) {
+			return false
+		}
+	}
+	if c.Boundary != other.Boundary || c.ClipMode != other.ClipMode || c.KernelCore != other.KernelCore || c.GridType != other.GridType ||
+		c.UseAsymmetricKernel != other.UseAsymmetricKernel ||
+		c.OffsetX != other.OffsetX || c.OffsetY != other.OffsetY || c.FFTPadFactor != other.FFTPadFactor ||
+		c.Step != other.Step || len(c.Beta) != len(other.Beta) {
+		return false
+	}
+	for k := range c.Beta {
+		if !within(c.Beta[k], other.Beta[k], tol) {
+			return false
+		}
+	}
+	return denseWithin(c.A, other.A, tol) &&
+		denseWithin(c.Kernel, other.Kernel, tol) &&
+		denseWithin(c.G, other.G, tol) &&
+		denseWithin(c.MuMap, other.MuMap, tol) &&
+		denseWithin(c.SigmaMap, other.SigmaMap, tol) &&
+		denseWithin(c.Mask, other.Mask, tol) &&
+		cDenseWithin(c.KFFT, other.KFFT, tol)
+}
+
+func within(a, b, tol float64) bool {
+	// absolute difference check, exact when tol is 0
+	// equal infinities are checked first as their difference is NaN
+	return a == b || math.Abs(a-b) <= tol
+}
+
+func denseWithin(a, b *mat.Dense, tol float64) bool {
+	// element-wise comparison of two matrices, both can be nil
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	ar, ac := a.Dims()
+	br, bc := b.Dims()
+	if ar != br || ac != bc {
+		return false
+	}
+	for i := 0; i < ar; i++ {
+		for j := 0; j < ac; j++ {
+			if !within(a.At(i, j), b.At(i, j), tol) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func cDenseWithin(a, b *mat.CDense, tol float64) bool {
+	// element-wise comparison of two complex matrices, both can be nil
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	ar, ac := a.Dims()
+	br, bc := b.Dims()
+	if ar != br || ac != bc {
+		return false
+	}
+	for i := 0; i < ar; i++ {
+		for j := 0; j < ac; j++ {
+			if x, y := a.At(i, j), b.At(i, j); x != y && !(cmplx.Abs(x-y) <= tol) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEqualInfinities(t *testing.T) {
+	// identical configs with infinite values are equal, with or without a tolerance
+	c := newTestConfig(t, 128, 1)
+	c.A.Set(0, 0, math.Inf(1))
+	c.A.Set(0, 1, math.Inf(-1))
+	other := c.Clone()
+	if !c.Equal(other) || !c.ApproxEqual(other, 1e-9) {
+		t.Fatal("identical configs with infinities are different")
+	}
+	other.A.Set(0, 0, math.Inf(-1))
+	if c.ApproxEqual(other, 1e-9) {
+		t.Fatal("opposite infinities are equal")
+	}
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// types of the events published by the simulation
+const (
+	// after each update, with the config and the time the update took
+	EventStep = "step"
+	// a parameter was changed from the UI, with its name and value
+	EventParamChange = "param_change"
+	// the kernel rings were changed, with R as the value and the new beta
+	EventParams = "params"
+	// the state was restarted
+	EventReset = "reset"
+	// the simulation became steady, with its kinetic energy
+	EventSteady = "steady"
+	// the simulation is moving again after being steady, with its kinetic energy
+	EventDiverge = "diverge"
+	// a checkpoint was written, with its path
+	EventSave = "save"
+	// the step is one of the config breakpoints, with the config
+	EventBreakpoint = "breakpoint"
+	// the mean of the state oscillates with a new period, in steps as the value (0 when it stops)
+	EventOscillation = "oscillation"
+)
+
+// something that happened in the simulation, only the fields relevant to its type are set
+type Event struct {
+	Type    string
+	Step    int
+	Config  *Config
+	Name    string
+	Value   float64
+	Beta    []float64
+	Path    string
+	Elapsed time.Duration
+}
+
+// dispatches the events to the handlers subscribed to their type
+// handlers run in the goroutine publishing the event: for EventStep the config is still locked
+type EventBus struct {
+	lock     sync.RWMutex
+	handlers map[string][]func(Event)
+}
+
+type ManageEventBus interface {
+	Subscribe()
+	Publish()
+}
+
+func NewEventBus() *EventBus {
+	// create a bus without subscribers
+	return &EventBus{handlers: map[string][]func(Event){}}
+}
+
+func (b *EventBus) Subscribe(eventType string, handler func(Event)) {
+	// call handler for every event of this type
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+func (b *EventBus) Publish(e Event) {
+	// call the handlers of the event type, in their subscription order
+	// a nil bus drops the events
+	if b == nil {
+		return
+	}
+	b.lock.RLock()
+	handlers := b.handlers[e.Type]
+	b.lock.RUnlock()
+	for _, handler := range handlers {
+		handler(e)
+	}
+}
@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// a collection of named patterns that can be stamped into the state
+type GliderLibrary struct {
+	Patterns map[string]*mat.Dense
+}
+
+type ManageGliderLibrary interface {
+	Add()
+	Stamp()
+	LoadFromDir()
+}
+
+func NewGliderLibrary() GliderLibrary {
+	// create an empty library
+	return GliderLibrary{Patterns: make(map[string]*mat.Dense)}
+}
+
+func (g *GliderLibrary) Add(name string, pattern *mat.Dense) {
+	// register a pattern under a name (replaces an existing one)
+	if g.Patterns == nil {
+		g.Patterns = make(map[string]*mat.Dense)
+	}
+	g.Patterns[name] = mat.DenseCopyOf(pattern)
+}
+
+func (g *GliderLibrary) Stamp(c *Config, name string, x, y int) error {
+	// copy the named pattern into the state, its top left corner at (x, y)
+	// the pattern wraps around the world edges
+	pattern, ok := g.Patterns[name]
+	if !ok {
+		return fmt.Errorf("unknown glider %q", name)
+	}
+	h, w := c.A.Dims()
+	ph, pw := pattern.Dims()
+	for i := 0; i < ph; i++ {
+		for j := 0; j < pw; j++ {
+			c.A.Set(mod(x+i, h), mod(y+j, w), pattern.At(i, j))
+		}
+	}
+	return nil
+}
+
+func (g *GliderLibrary) LoadFromDir(path string) error {
+	// register every .npy and .png file of a directory, named after the file
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		file := filepath.Join(path, entry.Name())
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		var pattern *mat.Dense
+		switch ext {
+		case ".npy":
+			pattern, err = loadNpy(file)
+		case ".png":
+			pattern, err = LoadGrayImage(file)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		g.Add(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())), pattern)
+	}
+	return nil
+}
+
+var npyShape = regexp.MustCompile(`'shape':\s*\((\d+),\s*(\d+),?\s*\)`)
+var npyDescr = regexp.MustCompile(`'descr':\s*'([<>|=]?)(f4|f8)'`)
+
+func loadNpy(path string) (*mat.Dense, error) {
+	// read a 2D float array saved with numpy.save
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 10 || !bytes.HasPrefix(data, []byte("\x93NUMPY")) {
+		return nil, errors.New("not a npy file")
+	}
+	// header length is stored on 2 bytes in version 1, 4 bytes after
+	var headerLen, offset int
+	if data[6] == 1 {
+		headerLen = int(binary.LittleEndian.Uint16(data[8:10]))
+		offset = 10
+	} else {
+		if len(data) < 12 {
+			return nil, errors.New("truncated npy header")
+		}
+		headerLen = int(binary.LittleEndian.Uint32(data[8:12]))
+		offset = 12
+	}
+	if len(data) < offset+headerLen {
+		return nil, errors.New("truncated npy header")
+	}
+	header := string(data[offset : offset+headerLen])
+	body := data[offset+headerLen:]
+	if strings.Contains(header, "'fortran_order': True") {
+		return nil, errors.New("fortran ordered arrays are not supported")
+	}
+	shape := npyShape.FindStringSubmatch(header)
+	descr := npyDescr.FindStringSubmatch(header)
+	if shape == nil || descr == nil {
+		return nil, errors.New("only 2D float32 or float64 arrays are supported")
+	}
+	r, _ := strconv.Atoi(shape[1])
+	c, _ := strconv.Atoi(shape[2])
+	var order binary.ByteOrder = binary.LittleEndian
+	if descr[1] == ">" {
+		order = binary.BigEndian
+	}
+	size := 8
+	if descr[2] == "f4" {
+		size = 4
+	}
+	if len(body) < r*c*size {
+		return nil, errors.New("truncated npy data")
+	}
+	values := make([]float64, r*c)
+	for k := range values {
+		if size == 8 {
+			values[k] = math.Float64frombits(order.Uint64(body[k*8:]))
+		} else {
+			values[k] = float64(math.Float32frombits(order.Uint32(body[k*4:])))
+		}
+	}
+	return mat.NewDense(r, c, values), nil
+}
@@ -0,0 +1,170 @@
+//go:build hdf5
+
+package utils
+
+import (
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/hdf5"
+)
+
+func SaveHDF5(path string, c *Config) error {
+	// save the state, the kernel, the kept states (if any) and the parameters to an HDF5 file:
+	// datasets /A, /Kernel, /Beta, /History (states x rows x columns) and one per scalar in /parameters
+	f, err := hdf5.CreateFile(path, hdf5.F_ACC_TRUNC)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := writeMatrix(&f.CommonFG, "A", c.A); err != nil {
+		return err
+	}
+	if err := writeMatrix(&f.CommonFG, "Kernel", c.Kernel); err != nil {
+		return err
+	}
+	if err := writeDataset(&f.CommonFG, "Beta", []uint{uint(len(c.Beta))}, hdf5.T_NATIVE_DOUBLE, c.Beta); err != nil {
+		return err
+	}
+	if history := c.History(); len(history) > 0 {
+		h, w := c.A.Dims()
+		data := make([]float64, 0, len(history)*h*w)
+		for _, state := range history {
+			data = append(data, mat.DenseCopyOf(state).RawMatrix().Data...)
+		}
+		if err := writeDataset(&f.CommonFG, "History", []uint{uint(len(history)), uint(h), uint(w)}, hdf5.T_NATIVE_DOUBLE, data); err != nil {
+			return err
+		}
+	}
+	g, err := f.CreateGroup("parameters")
+	if err != nil {
+		return err
+	}
+	defer g.Close()
+	for name, v := range hdf5Scalars(c) {
+		if err := writeDataset(&g.CommonFG, name, []uint{1}, hdf5.T_NATIVE_DOUBLE, []float64{*v}); err != nil {
+			return err
+		}
+	}
+	return writeDataset(&g.CommonFG, "Step", []uint{1}, hdf5.T_NATIVE_INT64, []int64{int64(c.Step)})
+}
+
+func LoadHDF5(path string) (Config, error) {
+	// read a world saved by SaveHDF5, the kernel is computed again from the parameters
+	f, err := hdf5.OpenFile(path, hdf5.F_ACC_RDONLY)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+	dims, A, err := readDataset(&f.CommonFG, "A")
+	if err != nil {
+		return Config{}, err
+	}
+	_, beta, err := readDataset(&f.CommonFG, "Beta")
+	if err != nil {
+		return Config{}, err
+	}
+	h, w := int(dims[0]), int(dims[1])
+	// placeholder parameters, replaced by the saved ones below
+	c, err := NewConfig(h, w, 1, 1, 0.5, 1, beta)
+	if err != nil {
+		return Config{}, err
+	}
+	c.A = mat.NewDense(h, w, A)
+	g, err := f.OpenGroup("parameters")
+	if err != nil {
+		return Config{}, err
+	}
+	defer g.Close()
+	for name, v := range hdf5Scalars(&c) {
+		_, data, err := readDataset(&g.CommonFG, name)
+		if err != nil {
+			return Config{}, err
+		}
+		*v = data[0]
+	}
+	dset, err := g.OpenDataset("Step")
+	if err != nil {
+		return Config{}, err
+	}
+	step := make([]int64, 1)
+	err = dset.Read(&step)
+	dset.Close()
+	if err != nil {
+		return Config{}, err
+	}
+	c.Step = int(step[0])
+	if err := ValidateConfig(&c); err != nil {
+		return Config{}, err
+	}
+	c.ComputeKernel()
+	// the kept states are optional
+	if f.LinkExists("History") {
+		dims, data, err := readDataset(&f.CommonFG, "History")
+		if err != nil {
+			return Config{}, err
+		}
+		n, size := int(dims[0]), int(dims[1]*dims[2])
+		history := make([]*mat.Dense, n)
+		for k := range history {
+			history[k] = mat.NewDense(int(dims[1]), int(dims[2]), data[k*size:(k+1)*size])
+		}
+		c.SetHistory(history)
+	}
+	return c, nil
+}
+
+func hdf5Scalars(c *Config) map[string]*float64 {
+	// scalar parameters saved in /parameters, by dataset name
+	return map[string]*float64{
+		"R":     &c.R,
+		"T":     &c.T,
+		"Mu":    &c.Mu,
+		"Sigma": &c.Sigma,
+		"Dt":    &c.Dt,
+		"Dx":    &c.Dx,
+	}
+}
+
+func writeMatrix(g *hdf5.CommonFG, name string, m *mat.Dense) error {
+	// write a matrix as a 2D dataset
+	r, c := m.Dims()
+	return writeDataset(g, name, []uint{uint(r), uint(c)}, hdf5.T_NATIVE_DOUBLE, mat.DenseCopyOf(m).RawMatrix().Data)
+}
+
+func writeDataset(g *hdf5.CommonFG, name string, dims []uint, dtype *hdf5.Datatype, data any) error {
+	// create a dataset of these dimensions and write data (a slice of their product length)
+	space, err := hdf5.CreateSimpleDataspace(dims, nil)
+	if err != nil {
+		return err
+	}
+	defer space.Close()
+	dset, err := g.CreateDataset(name, dtype, space)
+	if err != nil {
+		return err
+	}
+	defer dset.Close()
+	return dset.Write(data)
+}
+
+func readDataset(g *hdf5.CommonFG, name string) ([]uint, []float64, error) {
+	// read a dataset of doubles with its dimensions
+	dset, err := g.OpenDataset(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer dset.Close()
+	space := dset.Space()
+	defer space.Close()
+	dims, _, err := space.SimpleExtentDims()
+	if err != nil {
+		return nil, nil, err
+	}
+	n := 1
+	for _, d := range dims {
+		n *= int(d)
+	}
+	data := make([]float64, n)
+	if err := dset.Read(&data); err != nil {
+		return nil, nil, err
+	}
+	return dims, data, nil
+}
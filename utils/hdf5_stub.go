@@ -0,0 +1,18 @@
+//go:build !hdf5
+
+package utils
+
+import "errors"
+
+// the HDF5 bindings need cgo and the HDF5 C library
+var errNoHDF5 = errors.New("HDF5 needs gonum.org/v1/hdf5 and the HDF5 library, build with -tags hdf5")
+
+func SaveHDF5(path string, c *Config) error {
+	// not available without the hdf5 build tag
+	return errNoHDF5
+}
+
+func LoadHDF5(path string) (Config, error) {
+	// not available without the hdf5 build tag
+	return Config{}, errNoHDF5
+}
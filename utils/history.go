@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"image/color"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// the last states kept in a circular buffer, displayed as colored streaks
+type HistoryOverlay struct {
+	Enabled bool
+	frames  []*mat.Dense
+	// index of the next frame to overwrite and number of frames stored
+	next, count int
+}
+
+type ManageHistoryOverlay interface {
+	Push()
+	Clear()
+	GetColor()
+}
+
+func NewHistoryOverlay(k int) HistoryOverlay {
+	// create an overlay keeping the last k states
+	if k < 1 {
+		k = 1
+	}
+	return HistoryOverlay{frames: make([]*mat.Dense, k)}
+}
+
+func (h *HistoryOverlay) Push(A *mat.Dense) {
+	// store a copy of a state, replacing the oldest one if the buffer is full
+	if h.frames[h.next] == nil {
+		h.frames[h.next] = mat.DenseCopyOf(A)
+	} else {
+		h.frames[h.next].Copy(A)
+	}
+	h.next = (h.next + 1) % len(h.frames)
+	if h.count < len(h.frames) {
+		h.count++
+	}
+}
+
+func (h *HistoryOverlay) Clear() {
+	// forget all stored states
+	h.next = 0
+	h.count = 0
+}
+
+func (h *HistoryOverlay) GetColor(i, j int) color.Color {
+	// recent frames go in the red channel, older in green and oldest in blue
+	// each channel keeps the maximum value of its frames
+	var channels [3]float64
+	k := len(h.frames)
+	for age := 0; age < h.count; age++ {
+		frame := h.frames[mod(h.next-1-age, k)]
+		channel := age * 3 / k
+		if v := frame.At(i, j); v > channels[channel] {
+			channels[channel] = v
+		}
+	}
+	return color.RGBA{
+		uint8(Clip(channels[0], 0, 1) * 255),
+		uint8(Clip(channels[1], 0, 1) * 255),
+		uint8(Clip(channels[2], 0, 1) * 255),
+		0xff,
+	}
+}
@@ -4,11 +4,19 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"image/png"
 	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"fyne.io/fyne/v2"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
 )
 
 func CropImage(img image.Image, width, height int) image.Image {
@@ -28,12 +36,49 @@ func SaveImage(w fyne.Window, width, height int) error {
 	// capture the current rendered image
 	img := w.Canvas().Capture()
 	img = CropImage(img, width, height)
-	// create the file
+	// name the file after the current date
 	t := time.Now()
 	date := fmt.Sprintf("%d-%02d-%02dT%02d:%02d:%02d",
 		t.Year(), t.Month(), t.Day(),
 		t.Hour(), t.Minute(), t.Second())
 	path := fmt.Sprintf("images/%s.png", date)
+	return savePNG(img, path)
+}
+
+func SaveFrame(w fyne.Window, width, height, index int, dir string) error {
+	// capture the current rendered image as a numbered frame of a sequence
+	img := w.Canvas().Capture()
+	img = CropImage(img, width, height)
+	return saveFrameImage(img, index, dir)
+}
+
+func SaveStateFrame(A *mat.Dense, cm ColormapButton, index int, dir string) error {
+	// draw a state as a numbered frame of a sequence, without the window overlays
+	return saveFrameImage(RenderState(A, cm), index, dir)
+}
+
+func saveFrameImage(img image.Image, index int, dir string) error {
+	// save an image as the frame number index in dir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%06d.png", index))
+	return savePNG(img, path)
+}
+
+func InterpolateFrame(a, b *mat.Dense, t float64) *mat.Dense {
+	// linear blend between two states, a at t=0 and b at t=1
+	// the blend is kept between 0 and 1, as the soft clip lets the states go slightly outside
+	r, c := a.Dims()
+	m := mat.NewDense(r, c, nil)
+	m.Apply(func(i, j int, v float64) float64 {
+		return Clip((1-t)*v+t*b.At(i, j), 0, 1)
+	}, a)
+	return m
+}
+
+func savePNG(img image.Image, path string) error {
+	// create the file
 	file, err := os.Create(path)
 	if err != nil {
 		return err
@@ -46,3 +91,159 @@ func SaveImage(w fyne.Window, width, height int) error {
 	}
 	return nil
 }
+
+func LoadGrayImage(path string) (*mat.Dense, error) {
+	// read a PNG image as a matrix of gray levels between 0 and 1
+	// indexed by (x, y) like the state
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	m := mat.NewDense(bounds.Dx(), bounds.Dy(), nil)
+	m.Apply(func(i, j int, _ float64) float64 {
+		gray := color.Gray16Model.Convert(img.At(bounds.Min.X+i, bounds.Min.Y+j)).(color.Gray16)
+		return float64(gray.Y) / 0xffff
+	}, m)
+	return m, nil
+}
+
+func drawText(img draw.Image, x, y int, text string, col color.Color) {
+	// write a text with its baseline starting at (x, y)
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(col),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+func SaveHeatmap(m *mat.Dense, path, xLabel, yLabel string, xRange, yRange [2]float64) error {
+	// save a matrix indexed by (x, y) as a PNG heatmap with labeled axes
+	// values are scaled between their min and max and colored with viridis
+	const cell = 8
+	const margin = 50
+	nx, ny := m.Dims()
+	data := m.RawMatrix().Data
+	min, max := floats.Min(data), floats.Max(data)
+	img := image.NewRGBA(image.Rect(0, 0, nx*cell+margin+10, ny*cell+margin+10))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	for i := 0; i < nx; i++ {
+		for j := 0; j < ny; j++ {
+			v := 0.
+			if max > min {
+				v = (m.At(i, j) - min) / (max - min)
+			}
+			// y axis goes up
+			rect := image.Rect(margin+i*cell, (ny-1-j)*cell+10, margin+(i+1)*cell, (ny-j)*cell+10)
+			draw.Draw(img, rect, image.NewUniform(gradientColor(colormaps["Viridis"], v)), image.Point{}, draw.Src)
+		}
+	}
+	// axes labels and ranges
+	bottom := ny*cell + 10
+	drawText(img, margin, bottom+15, fmt.Sprintf("%.3g", xRange[0]), color.White)
+	drawText(img, margin+nx*cell-35, bottom+15, fmt.Sprintf("%.3g", xRange[1]), color.White)
+	drawText(img, margin+nx*cell/2-len(xLabel)*7/2, bottom+35, xLabel, color.White)
+	drawText(img, 2, bottom, fmt.Sprintf("%.3g", yRange[0]), color.White)
+	drawText(img, 2, 20, fmt.Sprintf("%.3g", yRange[1]), color.White)
+	drawText(img, 2, bottom/2, yLabel, color.White)
+	return savePNG(img, path)
+}
+
+func RenderState(A *mat.Dense, cm ColormapButton) *image.RGBA {
+	// draw the state with a colormap, pixel (x, y) being A(x, y)
+	w, h := A.Dims()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < w; i++ {
+		for j := 0; j < h; j++ {
+			img.Set(i, j, cm.GetColor(Clip(A.At(i, j), 0, 1)))
+		}
+	}
+	return img
+}
+
+func ExportAnnotated(c *Config, cm ColormapButton, path string) error {
+	// save the state as a PNG with the parameters written below it
+	const strip = 36
+	w, h := c.A.Dims()
+	img := image.NewRGBA(image.Rect(0, 0, w, h+strip))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, w, h), RenderState(c.A, cm), image.Point{}, draw.Src)
+	drawText(img, 4, h+14, fmt.Sprintf("R=%g T=%g Mu=%g Sigma=%g", c.R, c.T, c.Mu, c.Sigma), color.White)
+	drawText(img, 4, h+30, fmt.Sprintf("Beta=%s step=%d", BetaToFlag(c.Beta), c.Step), color.White)
+	return savePNG(img, path)
+}
+
+// a state kept for a collage, with the step it was taken at
+type CollageFrame struct {
+	Step int
+	A    *mat.Dense
+}
+
+func MakeCollage(frames []CollageFrame, cols int, cm ColormapButton) image.Image {
+	// arrange frames in a grid of cols columns separated by 1 pixel black borders
+	// each frame is labeled with its step number in its bottom-left corner
+	if len(frames) == 0 || cols < 1 {
+		return image.NewRGBA(image.Rect(0, 0, 0, 0))
+	}
+	w, h := frames[0].A.Dims()
+	rows := (len(frames) + cols - 1) / cols
+	img := image.NewRGBA(image.Rect(0, 0, cols*(w+1)+1, rows*(h+1)+1))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	for k, frame := range frames {
+		x := 1 + (k%cols)*(w+1)
+		y := 1 + (k/cols)*(h+1)
+		draw.Draw(img, image.Rect(x, y, x+w, y+h), RenderState(frame.A, cm), image.Point{}, draw.Src)
+		// white text on a black box to be readable on any state
+		label := strconv.Itoa(frame.Step)
+		box := image.Rect(x, y+h-15, x+len(label)*7+4, y+h)
+		draw.Draw(img, box, image.NewUniform(color.Black), image.Point{}, draw.Src)
+		drawText(img, x+2, y+h-3, label, color.White)
+	}
+	return img
+}
+
+func LoadMuMapFromImage(path string, c *Config, muMin, muMax float64) error {
+	// set a spatial Mu from a grayscale PNG of the size of the world, black is muMin and white muMax
+	gray, err := LoadGrayImage(path)
+	if err != nil {
+		return err
+	}
+	h, w := c.A.Dims()
+	if gh, gw := gray.Dims(); gh != h || gw != w {
+		return fmt.Errorf("mu map is %dx%d, the world is %dx%d", gh, gw, h, w)
+	}
+	gray.Apply(func(_, _ int, v float64) float64 {
+		return muMin + v*(muMax-muMin)
+	}, gray)
+	c.MuMap = gray
+	return nil
+}
+
+func LoadMaskFromImage(path string, c *Config) error {
+	// restrict the world to the white cells of a black and white PNG of its size
+	// gray levels are rounded to black or white
+	gray, err := LoadGrayImage(path)
+	if err != nil {
+		return err
+	}
+	h, w := c.A.Dims()
+	if gh, gw := gray.Dims(); gh != h || gw != w {
+		return fmt.Errorf("mask is %dx%d, the world is %dx%d", gh, gw, h, w)
+	}
+	gray.Apply(func(_, _ int, v float64) float64 {
+		if v < 0.5 {
+			return 0
+		}
+		return 1
+	}, gray)
+	c.Mask = gray
+	c.applyMask()
+	return nil
+}
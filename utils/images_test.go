@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"image"
+	"testing"
+
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/test"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestInterpolatedFramesStayInBounds(t *testing.T) {
+	// every frame blended between two steps is between 0 and 1, with the hard and the soft clip
+	for _, mode := range []ClipMode{ClipHard, ClipSoft} {
+		c := newTestConfig(t, 128, 1)
+		c.ClipMode = mode
+		for step := 0; step < 20; step++ {
+			previous := mat.DenseCopyOf(c.A)
+			c.Update()
+			for k := 0; k <= 10; k++ {
+				frame := InterpolateFrame(previous, c.A, float64(k)/10)
+				if min, max := mat.Min(frame), mat.Max(frame); min < 0 || max > 1 {
+					t.Fatalf("clip mode %d, step %d, t=%g: frame values from %g to %g", mode, step, float64(k)/10, min, max)
+				}
+			}
+		}
+		if frame := InterpolateFrame(c.A, c.A, 0.5); mode == ClipHard && !mat.Equal(frame, c.A) {
+			t.Error("the blend of a state with itself differs from the state")
+		}
+	}
+}
+
+func TestCollageLabels(t *testing.T) {
+	// each tile is labeled with the step of its frame, the label box growing with its digits
+	test.NewApp()
+	setup := NewSafeConfig(newTestConfig(t, 128, 1))
+	colors := [][]int{}
+	cm := CreateColormapButton(&colors, canvas.NewRaster(nil), setup)
+	// an empty state is white with the default colormap
+	empty := mat.NewDense(32, 32, nil)
+	img := MakeCollage([]CollageFrame{{Step: 7, A: empty}, {Step: 12345, A: empty}}, 2, cm)
+	if got, want := img.Bounds().Size(), image.Pt(2*33+1, 33+1); got != want {
+		t.Fatalf("collage of size %v, want %v", got, want)
+	}
+	// 20 pixels right of the tile corner: past the box of "7", inside the box of "12345"
+	r, _, _, _ := img.At(1+20, 32).RGBA()
+	if r == 0 {
+		t.Error("the label of step 7 is too wide")
+	}
+	if r, g, b, _ := img.At(34+20, 32).RGBA(); r != 0 || g != 0 || b != 0 {
+		t.Error("the label of step 12345 is too narrow")
+	}
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"image/color"
+	"math"
+)
+
+// D65 white point of the XYZ color space
+const whiteX, whiteY, whiteZ = 0.95047, 1.0, 1.08883
+
+// number of precomputed colors of a perceptual gradient
+const perceptualLevels = 256
+
+// gradient interpolated in CIELAB instead of RGB, its colors are precomputed
+type perceptualColormap struct {
+	// Config.PerceptualColormap of the drawn config, only accessed with it locked
+	enabled *bool
+	lut     []color.RGBA
+}
+
+func srgbToLinear(v float64) float64 {
+	// gamma expansion of an sRGB component between 0 and 1
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) float64 {
+	// gamma compression of a linear component between 0 and 1
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+func labF(t float64) float64 {
+	// CIELAB companding function
+	if t > 216.0/24389 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27*t + 16) / 116
+}
+
+func labFInverse(t float64) float64 {
+	// inverse of labF
+	if t*t*t > 216.0/24389 {
+		return t * t * t
+	}
+	return (116*t - 16) * 27 / 24389
+}
+
+func RGBToLab(r, g, b uint8) (L, A, B float64) {
+	// convert an sRGB color to CIELAB (D65)
+	lr := srgbToLinear(float64(r) / 255)
+	lg := srgbToLinear(float64(g) / 255)
+	lb := srgbToLinear(float64(b) / 255)
+	x := (0.4124564*lr + 0.3575761*lg + 0.1804375*lb) / whiteX
+	y := (0.2126729*lr + 0.7151522*lg + 0.0721750*lb) / whiteY
+	z := (0.0193339*lr + 0.1191920*lg + 0.9503041*lb) / whiteZ
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+func LabToRGB(L, A, B float64) color.RGBA {
+	// convert a CIELAB (D65) color to sRGB, the colors out of the sRGB gamut are clipped
+	fy := (L + 16) / 116
+	fx := fy + A/500
+	fz := fy - B/200
+	x := labFInverse(fx) * whiteX
+	y := labFInverse(fy) * whiteY
+	z := labFInverse(fz) * whiteZ
+	lr := 3.2404542*x - 1.5371385*y - 0.4985314*z
+	lg := -0.9692660*x + 1.8760108*y + 0.0415560*z
+	lb := 0.0556434*x - 0.2040259*y + 1.0572252*z
+	component := func(v float64) uint8 {
+		return uint8(math.Round(Clip(linearToSRGB(Clip(v, 0, 1)), 0, 1) * 255))
+	}
+	return color.RGBA{component(lr), component(lg), component(lb), 0xff}
+}
+
+func perceptualGradient(colors [][]int) []color.RGBA {
+	// colors of a gradient defined by color stops, interpolated in CIELAB so that
+	// equal steps of value look like equal steps of color
+	labs := make([][3]float64, len(colors))
+	for k, c := range colors {
+		L, A, B := RGBToLab(uint8(c[0]), uint8(c[1]), uint8(c[2]))
+		labs[k] = [3]float64{L, A, B}
+	}
+	lut := make([]color.RGBA, perceptualLevels)
+	for n := range lut {
+		scaledV := float64(n) / (perceptualLevels - 1) * float64(len(colors)-1)
+		index1 := int(math.Floor(scaledV))
+		index2 := int(math.Ceil(scaledV))
+		x := scaledV - float64(index1)
+		var lab [3]float64
+		for d := range lab {
+			lab[d] = labs[index1][d] + (labs[index2][d]-labs[index1][d])*x
+		}
+		lut[n] = LabToRGB(lab[0], lab[1], lab[2])
+	}
+	return lut
+}
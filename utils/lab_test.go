@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLabRoundTrip(t *testing.T) {
+	// converting a color to CIELAB and back gives the same color
+	for r := 0; r < 256; r += 15 {
+		for g := 0; g < 256; g += 15 {
+			for b := 0; b < 256; b += 15 {
+				got := LabToRGB(RGBToLab(uint8(r), uint8(g), uint8(b)))
+				if int(got.R) != r || int(got.G) != g || int(got.B) != b {
+					t.Fatalf("(%d, %d, %d) comes back as (%d, %d, %d)", r, g, b, got.R, got.G, got.B)
+				}
+			}
+		}
+	}
+	// reference values of the D65 white and of the sRGB red
+	if L, A, B := RGBToLab(255, 255, 255); math.Abs(L-100) > 1e-3 || math.Abs(A) > 1e-3 || math.Abs(B) > 1e-3 {
+		t.Errorf("white is (%g, %g, %g) in CIELAB", L, A, B)
+	}
+	if L, A, B := RGBToLab(255, 0, 0); math.Abs(L-53.24) > 0.01 || math.Abs(A-80.09) > 0.01 || math.Abs(B-67.20) > 0.01 {
+		t.Errorf("red is (%g, %g, %g) in CIELAB", L, A, B)
+	}
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"encoding/csv"
+	"os"
+)
+
+// writes rows of values to a CSV file
+type CSVLogger struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+type ManageCSVLogger interface {
+	Log()
+	Close()
+}
+
+func NewCSVLogger(path string, header []string) (*CSVLogger, error) {
+	// create the file and write the column names
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &CSVLogger{file: file, writer: csv.NewWriter(file)}
+	if err := l.Log(header...); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *CSVLogger) Log(values ...string) error {
+	// write a row and flush it so the file can be followed during the run
+	if err := l.writer.Write(values); err != nil {
+		return err
+	}
+	l.writer.Flush()
+	return l.writer.Error()
+}
+
+func (l *CSVLogger) Close() error {
+	// flush and close the file
+	l.writer.Flush()
+	return l.file.Close()
+}
@@ -0,0 +1,330 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+)
+
+func MeanState(c *Config) float64 {
+	// average value of the state
+	return stat.Mean(c.A.RawMatrix().Data, nil)
+}
+
+func VarianceState(c *Config) float64 {
+	// variance of the state values
+	return stat.Variance(c.A.RawMatrix().Data, nil)
+}
+
+func KineticEnergy(prev, curr *mat.Dense) float64 {
+	// mean squared change of the cells between two states, near 0 for a static state
+	r, c := curr.Dims()
+	diff := mat.NewDense(r, c, nil)
+	diff.Sub(curr, prev)
+	norm := mat.Norm(diff, 2)
+	return norm * norm / float64(r*c)
+}
+
+func Entropy(c *Config) float64 {
+	// shannon entropy (in bits) of the histogram of the state values over 256 bins
+	var histogram [256]float64
+	data := c.A.RawMatrix().Data
+	for _, v := range data {
+		histogram[int(Clip(v, 0, 1)*255)]++
+	}
+	entropy := 0.
+	for _, n := range histogram {
+		if n > 0 {
+			p := n / float64(len(data))
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+func MDLComplexity(c *Config) float64 {
+	// ratio of the zlib compressed size to the raw size of the state quantized to 8 bits,
+	// a cheap proxy of its Kolmogorov complexity: low for simple or repetitive patterns
+	data := c.A.RawMatrix().Data
+	raw := make([]byte, len(data))
+	for k, v := range data {
+		raw[k] = uint8(math.Round(Clip(v, 0, 1) * 255))
+	}
+	// writing to a buffer can not fail
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write(raw)
+	w.Close()
+	return float64(compressed.Len()) / float64(len(raw))
+}
+
+func SpatialMeanMap(c *Config, n int) *mat.Dense {
+	// run n steps and average the state of each cell over them
+	// persistently active regions stand out, like standing waves
+	h, w := c.A.Dims()
+	sum := mat.NewDense(h, w, nil)
+	for step := 0; step < n; step++ {
+		c.Update()
+		sum.Add(sum, c.A)
+	}
+	sum.Scale(1/float64(n), sum)
+	return sum
+}
+
+func AzimuthalAverage(m *mat.Dense, bins int) []float64 {
+	// average a matrix over rings around its center, from the center (bin 0)
+	// to the largest circle it contains (the corners are left out)
+	r, c := m.Dims()
+	maxRadius := math.Min(float64(r), float64(c)) / 2
+	sums := make([]float64, bins)
+	counts := make([]int, bins)
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			k := int(math.Hypot(float64(i-r/2), float64(j-c/2)) / maxRadius * float64(bins))
+			if k < bins {
+				sums[k] += m.At(i, j)
+				counts[k]++
+			}
+		}
+	}
+	for k := range sums {
+		if counts[k] > 0 {
+			sums[k] /= float64(counts[k])
+		}
+	}
+	return sums
+}
+
+func RadialPowerSpectrum(c *Config, bins int) []float64 {
+	// power of the state FFT averaged over rings of spatial frequency, from 0 to the Nyquist frequency
+	F := FFT(c.A)
+	r, cols := F.Dims()
+	power := mat.NewDense(r, cols, nil)
+	power.Apply(func(i, j int, _ float64) float64 {
+		// zero frequency moved to the center
+		z := F.At(mod(i-r/2, r), mod(j-cols/2, cols))
+		return real(z)*real(z) + imag(z)*imag(z)
+	}, power)
+	return AzimuthalAverage(power, bins)
+}
+
+func Spectrogram(c *Config, steps, freqBins int) *mat.Dense {
+	// run steps updates and stack the radial power spectrum of each one
+	// rows are frequencies and columns are steps, like an audio spectrogram
+	spectrogram := mat.NewDense(freqBins, steps, nil)
+	for step := 0; step < steps; step++ {
+		c.Update()
+		spectrogram.SetCol(step, RadialPowerSpectrum(c, freqBins))
+	}
+	return spectrogram
+}
+
+func GrowthResonance(c *Config) float64 {
+	// overlap of the kernel power spectrum with the linearized growth rate of each spatial frequency,
+	// around the uniform state where the growth is zero and increasing (U = Mu - Sigma*sqrt(2 ln 2))
+	// a perturbation of frequency f there grows by Dt*G'(U)*K(f) per step, K(f) being the kernel
+	// Fourier transform, so a positive value means that the frequencies carried by the kernel
+	// break the uniform state into patterns (Turing instability), a negative one that they fade out
+	// the scalar Mu and Sigma are used even with maps
+	r, cols := c.A.Dims()
+	spectrum := FullSpectrum(c.KFFT, r)
+	centered := func(value func(z complex128) float64) *mat.Dense {
+		m := mat.NewDense(r, cols, nil)
+		m.Apply(func(i, j int, _ float64) float64 {
+			// zero frequency moved to the center
+			return value(spectrum.At(mod(i-r/2, r), mod(j-cols/2, cols)))
+		}, m)
+		return m
+	}
+	bins := min(r, cols) / 2
+	response := AzimuthalAverage(centered(func(z complex128) float64 { return real(z) }), bins)
+	power := AzimuthalAverage(centered(func(z complex128) float64 { return real(z)*real(z) + imag(z)*imag(z) }), bins)
+	u := math.Max(c.Mu-c.Sigma*math.Sqrt(2*math.Ln2), 0)
+	d := u - c.Mu
+	slope := -2 * d / (c.Sigma * c.Sigma) * math.Exp(-d*d/(2*c.Sigma*c.Sigma))
+	// the uniform mode (bin 0) is left out, it does not make patterns
+	overlap, total := 0., 0.
+	for f := 1; f < bins; f++ {
+		overlap += power[f] * c.Dt * slope * response[f]
+		total += power[f]
+	}
+	if total == 0 {
+		return 0
+	}
+	return overlap / total
+}
+
+// autocorrelation the series needs at a lag for it to be a period
+const oscillationCorrelation = 0.5
+
+func OscillationPeriod(series []float64, maxPeriod int) int {
+	// dominant period of a series from its autocorrelation, 0 if it is not periodic
+	// the period is the first lag whose autocorrelation peaks close to the highest peak,
+	// so that multiples of the period are not returned
+	n := len(series)
+	if maxPeriod > n/2 {
+		maxPeriod = n / 2
+	}
+	mean := stat.Mean(series, nil)
+	variance := 0.
+	for _, v := range series {
+		variance += (v - mean) * (v - mean)
+	}
+	// a constant series has no period, whatever its rounding errors
+	if variance/float64(n) < 1e-18 {
+		return 0
+	}
+	correlation := make([]float64, maxPeriod+2)
+	for lag := 1; lag < len(correlation) && lag < n; lag++ {
+		sum := 0.
+		for k := 0; k+lag < n; k++ {
+			sum += (series[k] - mean) * (series[k+lag] - mean)
+		}
+		// rescaled by the number of pairs so that long lags are not penalized
+		correlation[lag] = sum / float64(n-lag) * float64(n) / variance
+	}
+	// local maxima of the autocorrelation above the threshold, lag 1 is a steady state
+	best := 0.
+	var peaks []int
+	for lag := 2; lag <= maxPeriod; lag++ {
+		if correlation[lag] >= oscillationCorrelation && correlation[lag] >= correlation[lag-1] && correlation[lag] > correlation[lag+1] {
+			peaks = append(peaks, lag)
+			best = math.Max(best, correlation[lag])
+		}
+	}
+	for _, lag := range peaks {
+		if correlation[lag] >= 0.9*best {
+			return lag
+		}
+	}
+	return 0
+}
+
+func DetectOscillationPeriod(c *Config, maxPeriod, steps int) int {
+	// run steps updates and return the dominant period of the mean of the state, 0 if there is none
+	series := make([]float64, steps)
+	for step := range series {
+		c.Update()
+		series[step] = MeanState(c)
+	}
+	return OscillationPeriod(series, maxPeriod)
+}
+
+func CountComponents(c *Config, threshold float64) (count int, sizes []int) {
+	// label the 4-connected groups of cells above threshold (the world wraps around)
+	// and return their number and their sizes in increasing order
+	h, w := c.A.Dims()
+	visited := make([]bool, h*w)
+	queue := make([]int, 0, h*w)
+	for start := 0; start < h*w; start++ {
+		if visited[start] || c.A.At(start/w, start%w) <= threshold {
+			continue
+		}
+		// breadth first search from a new component
+		visited[start] = true
+		queue = append(queue[:0], start)
+		size := 0
+		for len(queue) > 0 {
+			k := queue[0]
+			queue = queue[1:]
+			size++
+			i, j := k/w, k%w
+			neighbors := [4][2]int{
+				{mod(i-1, h), j},
+				{mod(i+1, h), j},
+				{i, mod(j-1, w)},
+				{i, mod(j+1, w)},
+			}
+			for _, n := range neighbors {
+				index := n[0]*w + n[1]
+				if !visited[index] && c.A.At(n[0], n[1]) > threshold {
+					visited[index] = true
+					queue = append(queue, index)
+				}
+			}
+		}
+		sizes = append(sizes, size)
+	}
+	sort.Ints(sizes)
+	return len(sizes), sizes
+}
+
+// a connected component of the superlevel sets of the state, appearing at the level Birth
+// and merged into an older component at the level Death (Birth >= Death)
+type PersistencePair struct {
+	Birth, Death float64
+}
+
+func PersistenceDiagram(c *Config, threshold float64) []PersistencePair {
+	// 0-dimensional persistence of the state: the level goes down from 1 to 0 and the 4-connected groups
+	// of cells above it (the world wraps around) are born at local maxima and die when they merge,
+	// the younger one dying (elder rule); the oldest one dies at the minimum of the state
+	// pairs living less than threshold are left out as noise
+	h, w := c.A.Dims()
+	data := c.A.RawMatrix()
+	value := func(k int) float64 {
+		return data.Data[(k/w)*data.Stride+k%w]
+	}
+	order := make([]int, h*w)
+	for k := range order {
+		order[k] = k
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return value(order[a]) > value(order[b])
+	})
+	// union-find over the cells already above the level, each root keeps the birth of its component
+	parent := make([]int, h*w)
+	for k := range parent {
+		parent[k] = -1
+	}
+	var find func(k int) int
+	find = func(k int) int {
+		if parent[k] != k {
+			parent[k] = find(parent[k])
+		}
+		return parent[k]
+	}
+	birth := make([]float64, h*w)
+	var pairs []PersistencePair
+	for _, k := range order {
+		level := value(k)
+		parent[k] = k
+		birth[k] = level
+		i, j := k/w, k%w
+		neighbors := [4]int{
+			mod(i-1, h)*w + j,
+			mod(i+1, h)*w + j,
+			i*w + mod(j-1, w),
+			i*w + mod(j+1, w),
+		}
+		for _, n := range neighbors {
+			if parent[n] < 0 {
+				continue
+			}
+			a, b := find(k), find(n)
+			if a == b {
+				continue
+			}
+			// the younger component (lower birth) dies at this level
+			if birth[a] > birth[b] {
+				a, b = b, a
+			}
+			if birth[a]-level >= threshold {
+				pairs = append(pairs, PersistencePair{Birth: birth[a], Death: level})
+			}
+			parent[a] = b
+		}
+	}
+	// the components left never merged
+	minimum := value(order[len(order)-1])
+	for k := range parent {
+		if parent[k] == k && birth[k]-minimum >= threshold {
+			pairs = append(pairs, PersistencePair{Birth: birth[k], Death: minimum})
+		}
+	}
+	return pairs
+}
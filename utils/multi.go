@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"image/color"
+	"sync"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// a species living in a multi-channel world, with the color it is drawn with
+type Channel struct {
+	Config
+	// red, green and blue weights between 0 and 1
+	ChannelColor [3]float64
+}
+
+// several channels sharing the same world, drawn as an additive mix of their colors
+// the channels do not interact yet, each one grows from its own potential
+type MultiConfig struct {
+	Channels []Channel
+}
+
+type ManageMultiConfig interface {
+	Update()
+	GetColor()
+}
+
+func NewMultiConfig(base *Config, colors [][3]float64) MultiConfig {
+	// create one channel per color sharing the parameters and kernel of base, each with its own random state
+	m := MultiConfig{Channels: make([]Channel, len(colors))}
+	h, w := base.A.Dims()
+	for k := range m.Channels {
+		m.Channels[k].Config = base.Clone()
+		m.Channels[k].SetSeed(base.Seed + int64(k) + 1)
+		m.Channels[k].A = mat.NewDense(h, w, nil)
+		m.Channels[k].InitState()
+		m.Channels[k].ChannelColor = colors[k]
+	}
+	return m
+}
+
+func (m *MultiConfig) Update() {
+	// compute the next state of every channel, in parallel
+	var wg sync.WaitGroup
+	for k := range m.Channels {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			m.Channels[k].Update()
+		}(k)
+	}
+	wg.Wait()
+}
+
+func (m *MultiConfig) GetColor(i, j int) color.Color {
+	// sum of the channel colors weighted by the channel states, like false colored fluorescence
+	var rgb [3]float64
+	for _, ch := range m.Channels {
+		v := ch.A.At(i, j)
+		for k := range rgb {
+			rgb[k] += v * ch.ChannelColor[k]
+		}
+	}
+	return color.RGBA{
+		uint8(Clip(rgb[0], 0, 1) * 255),
+		uint8(Clip(rgb[1], 0, 1) * 255),
+		uint8(Clip(rgb[2], 0, 1) * 255),
+		0xff,
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"math"
+	"math/rand"
+)
+
+// gradient noise on a periodic lattice
+type perlinNoise struct {
+	period    int
+	gradients [][2]float64
+}
+
+func newPerlinNoise(r *rand.Rand, period int) perlinNoise {
+	// draw a random unit gradient at each node of a period x period lattice
+	if period < 1 {
+		period = 1
+	}
+	n := perlinNoise{period: period, gradients: make([][2]float64, period*period)}
+	for k := range n.gradients {
+		angle := 2 * math.Pi * r.Float64()
+		n.gradients[k] = [2]float64{math.Cos(angle), math.Sin(angle)}
+	}
+	return n
+}
+
+func fade(t float64) float64 {
+	// perlin smoothstep 6t^5 - 15t^4 + 10t^3
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func (n perlinNoise) dot(i, j int, x, y float64) float64 {
+	// dot product of the gradient at node (i, j) and the offset to (x, y)
+	g := n.gradients[mod(i, n.period)*n.period+mod(j, n.period)]
+	return g[0]*(x-float64(i)) + g[1]*(y-float64(j))
+}
+
+func (n perlinNoise) At(u, v float64) float64 {
+	// noise value at (u, v) in [0, 1)², periodic of period 1
+	x := u * float64(n.period)
+	y := v * float64(n.period)
+	i := int(math.Floor(x))
+	j := int(math.Floor(y))
+	sx := fade(x - float64(i))
+	sy := fade(y - float64(j))
+	top := n.dot(i, j, x, y) + sx*(n.dot(i+1, j, x, y)-n.dot(i, j, x, y))
+	bottom := n.dot(i, j+1, x, y) + sx*(n.dot(i+1, j+1, x, y)-n.dot(i, j+1, x, y))
+	return top + sy*(bottom-top)
+}
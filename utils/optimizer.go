@@ -0,0 +1,321 @@
+package utils
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// parameters of a run of a sweep and its metrics at the end
+type SweepResult struct {
+	Params  Params
+	Metrics map[string]float64
+}
+
+// group of sweep results with similar metrics
+type Cluster struct {
+	// mean of the metrics of the members
+	Centroid map[string]float64
+	// indexes of the members in the results
+	Members []int
+	// parameters of the member closest to the centroid
+	Preset Preset
+}
+
+// Metropolis random walk in the (Mu, Sigma, Beta) space, towards parameters giving complex patterns
+type RandomWalkExplorer struct {
+	// parameters at the current position of the walk and their metric
+	Current Params
+	Score   float64
+	// metric maximized by the walk, "complexity" by default
+	Metric string
+	// standard deviation of the gaussian perturbation of Mu, Sigma and of a Beta element
+	MuStep, SigmaStep, BetaStep float64
+	// a decrease d of the metric is accepted with probability exp(-d/Temperature)
+	Temperature float64
+	// number of steps of each run, always from the same seed so that the runs compare
+	Steps int
+	Seed  int64
+	// accepted positions of the walk, in order
+	Catalog []Preset
+	rng     *rand.Rand
+}
+
+type ManageRandomWalkExplorer interface {
+	Walk()
+}
+
+func NewRandomWalkExplorer(start Params, steps int, seed int64) *RandomWalkExplorer {
+	// explorer starting at start, the start is the first entry of the catalog once the walk begins
+	return &RandomWalkExplorer{
+		Current:     start,
+		Metric:      "complexity",
+		MuStep:      0.01,
+		SigmaStep:   0.002,
+		BetaStep:    0.1,
+		Temperature: 0.01,
+		Steps:       steps,
+		Seed:        seed,
+		rng:         rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (e *RandomWalkExplorer) evaluate(p Params) (float64, error) {
+	// metric of a run of the parameters after e.Steps steps
+	metric, ok := Metrics[e.Metric]
+	if !ok {
+		return 0, fmt.Errorf("unknown metric %q", e.Metric)
+	}
+	c, err := p.NewConfig(e.Seed)
+	if err != nil {
+		return 0, err
+	}
+	for s := 0; s < e.Steps; s++ {
+		c.Update()
+	}
+	return metric(&c), nil
+}
+
+func (e *RandomWalkExplorer) propose() (Params, bool) {
+	// copy of the current parameters with one of them perturbed, false if the kernel would be empty
+	// or the parameters invalid
+	p := e.Current
+	p.Beta = append([]float64(nil), e.Current.Beta...)
+	switch k := e.rng.Intn(2 + len(p.Beta)); k {
+	case 0:
+		p.Mu = Clip(p.Mu+e.rng.NormFloat64()*e.MuStep, 0.001, 0.999)
+	case 1:
+		p.Sigma = Clip(p.Sigma+e.rng.NormFloat64()*e.SigmaStep, 0.0001, 1)
+	default:
+		p.Beta[k-2] = Clip(p.Beta[k-2]+e.rng.NormFloat64()*e.BetaStep, 0, 1)
+	}
+	if p.Validate() != nil {
+		return p, false
+	}
+	for _, b := range p.Beta {
+		if b > 0 {
+			return p, true
+		}
+	}
+	return p, false
+}
+
+func (e *RandomWalkExplorer) Walk(n int) (accepted int, err error) {
+	// make n steps of the walk, each one running a simulation, and return the number of accepted moves
+	if e.rng == nil {
+		e.rng = rand.New(rand.NewSource(e.Seed))
+	}
+	if len(e.Catalog) == 0 {
+		if e.Score, err = e.evaluate(e.Current); err != nil {
+			return 0, err
+		}
+		e.Catalog = append(e.Catalog, Preset{Name: "walk start", Seed: e.Seed, Params: e.Current})
+	}
+	for k := 0; k < n; k++ {
+		p, ok := e.propose()
+		if !ok {
+			continue
+		}
+		score, err := e.evaluate(p)
+		if err != nil {
+			return accepted, err
+		}
+		// Metropolis criterion: always go up, go down with a probability decreasing with the loss
+		if score < e.Score && e.rng.Float64() >= math.Exp((score-e.Score)/e.Temperature) {
+			continue
+		}
+		e.Current, e.Score = p, score
+		accepted++
+		e.Catalog = append(e.Catalog, Preset{Name: fmt.Sprintf("walk %d (%s %.4g)", k+1, e.Metric, score), Seed: e.Seed, Params: p})
+		slog.Debug("walk move accepted", "step", k+1, e.Metric, score, "mu", p.Mu, "sigma", p.Sigma, "beta", p.Beta)
+	}
+	return accepted, nil
+}
+
+// k-means stops after this number of iterations if the clusters still change
+const maxKMeansIterations = 100
+
+func SweepMuSigma(base Params, mus, sigmas []float64, seed int64, steps int, metrics []string) ([]SweepResult, error) {
+	// run base with every (Mu, Sigma) pair, one run per CPU at a time, and return the metrics at the end
+	// unknown metric names are ignored, the runs start only if every pair is valid
+	for _, mu := range mus {
+		for _, sigma := range sigmas {
+			p := base
+			p.Mu, p.Sigma = mu, sigma
+			if err := p.Validate(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	results := make([]SweepResult, len(mus)*len(sigmas))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range indexes {
+				p := base
+				p.Mu, p.Sigma = mus[k/len(sigmas)], sigmas[k%len(sigmas)]
+				// the parameters are validated above
+				c, _ := p.NewConfig(seed)
+				for s := 0; s < steps; s++ {
+					c.Update()
+				}
+				results[k] = SweepResult{Params: p, Metrics: map[string]float64{}}
+				for _, name := range metrics {
+					if metric, ok := Metrics[name]; ok {
+						results[k].Metrics[name] = metric(&c)
+					}
+				}
+			}
+		}()
+	}
+	for k := range results {
+		indexes <- k
+	}
+	close(indexes)
+	wg.Wait()
+	return results, nil
+}
+
+func ClusterPresets(results []SweepResult, k int) []Cluster {
+	// group the results in k clusters with k-means on their metrics
+	// each metric is scaled to a unit variance first so that they weigh the same
+	if k > len(results) {
+		k = len(results)
+	}
+	if k < 1 {
+		return nil
+	}
+	var names []string
+	for name := range results[0].Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	points := normalizedMetrics(results, names)
+	// deterministic start: the first result, then each time the farthest one from the chosen centroids
+	centroids := [][]float64{append([]float64(nil), points[0]...)}
+	for len(centroids) < k {
+		farthest, farthestDistance := 0, -1.
+		for n, p := range points {
+			if d := squaredDistance(p, centroids[nearest(p, centroids)]); d > farthestDistance {
+				farthest, farthestDistance = n, d
+			}
+		}
+		centroids = append(centroids, append([]float64(nil), points[farthest]...))
+	}
+	assignment := make([]int, len(points))
+	for iteration := 0; iteration < maxKMeansIterations; iteration++ {
+		changed := iteration == 0
+		for n, p := range points {
+			if c := nearest(p, centroids); c != assignment[n] {
+				assignment[n] = c
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		// move the centroids to the mean of their points, an empty cluster keeps its centroid
+		sums := make([][]float64, k)
+		counts := make([]int, k)
+		for n, p := range points {
+			c := assignment[n]
+			if sums[c] == nil {
+				sums[c] = make([]float64, len(names))
+			}
+			for d, v := range p {
+				sums[c][d] += v
+			}
+			counts[c]++
+		}
+		for c := range centroids {
+			for d := range centroids[c] {
+				if counts[c] > 0 {
+					centroids[c][d] = sums[c][d] / float64(counts[c])
+				}
+			}
+		}
+	}
+	clusters := make([]Cluster, k)
+	for n := range points {
+		clusters[assignment[n]].Members = append(clusters[assignment[n]].Members, n)
+	}
+	for c := range clusters {
+		if len(clusters[c].Members) == 0 {
+			continue
+		}
+		// centroid in the original metric units and closest member
+		clusters[c].Centroid = map[string]float64{}
+		for _, name := range names {
+			for _, n := range clusters[c].Members {
+				clusters[c].Centroid[name] += results[n].Metrics[name] / float64(len(clusters[c].Members))
+			}
+		}
+		closest := clusters[c].Members[0]
+		for _, n := range clusters[c].Members {
+			if squaredDistance(points[n], centroids[c]) < squaredDistance(points[closest], centroids[c]) {
+				closest = n
+			}
+		}
+		clusters[c].Preset = Preset{
+			Name:   fmt.Sprintf("cluster %d (%d runs)", c+1, len(clusters[c].Members)),
+			Params: results[closest].Params,
+		}
+	}
+	return clusters
+}
+
+func normalizedMetrics(results []SweepResult, names []string) [][]float64 {
+	// metric vectors of the results, each metric centered and scaled to a unit variance
+	points := make([][]float64, len(results))
+	for n := range results {
+		points[n] = make([]float64, len(names))
+		for d, name := range names {
+			points[n][d] = results[n].Metrics[name]
+		}
+	}
+	for d := range names {
+		mean, variance := 0., 0.
+		for _, p := range points {
+			mean += p[d] / float64(len(points))
+		}
+		for _, p := range points {
+			variance += (p[d] - mean) * (p[d] - mean) / float64(len(points))
+		}
+		// a constant metric does not separate anything
+		scale := 0.
+		if variance > 0 {
+			scale = 1 / math.Sqrt(variance)
+		}
+		for _, p := range points {
+			p[d] = (p[d] - mean) * scale
+		}
+	}
+	return points
+}
+
+func nearest(p []float64, centroids [][]float64) int {
+	// index of the centroid closest to p
+	best := 0
+	for c := range centroids {
+		if squaredDistance(p, centroids[c]) < squaredDistance(p, centroids[best]) {
+			best = c
+		}
+	}
+	return best
+}
+
+func squaredDistance(a, b []float64) float64 {
+	// squared euclidean distance between two vectors of the same length
+	d := 0.
+	for k := range a {
+		d += (a[k] - b[k]) * (a[k] - b[k])
+	}
+	return d
+}
@@ -0,0 +1,27 @@
+package utils
+
+import "testing"
+
+func TestSweepMuSigmaOrder(t *testing.T) {
+	// the results follow the grid order, Sigma varying fastest, whatever the scheduling
+	base := Params{Width: 128, Height: 128, R: 13, T: 10, Mu: 0.15, Sigma: 0.015, Beta: []float64{1}}
+	mus, sigmas := []float64{0.14, 0.15}, []float64{0.014, 0.015, 0.016}
+	results, err := SweepMuSigma(base, mus, sigmas, 1, 2, []string{"mean"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(mus)*len(sigmas) {
+		t.Fatalf("%d results, want %d", len(results), len(mus)*len(sigmas))
+	}
+	for a, mu := range mus {
+		for b, sigma := range sigmas {
+			r := results[a*len(sigmas)+b]
+			if r.Params.Mu != mu || r.Params.Sigma != sigma {
+				t.Fatalf("result %d has (%g, %g), want (%g, %g)", a*len(sigmas)+b, r.Params.Mu, r.Params.Sigma, mu, sigma)
+			}
+			if _, ok := r.Metrics["mean"]; !ok {
+				t.Fatalf("result %d has no mean", a*len(sigmas)+b)
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"image"
 	"image/color"
 	"math"
 	"strconv"
@@ -18,8 +19,9 @@ import (
 type Parameter struct {
 	Bind   binding.Float
 	Slider *widget.Slider
-	// pointer to the variable it is linked to
+	// pointer to the variable it is linked to and the config holding it
 	variable *float64
+	setup    *SafeConfig
 }
 
 type ManageParameter interface {
@@ -29,14 +31,16 @@ type ManageParameter interface {
 	CreateSlider()
 	GetSliderBox()
 	OnSliderChange()
-	OnSliderChangeOther()
+	Set()
 	Update()
+	UpdateThen()
 }
 
-func (p *Parameter) Initialize(value float64, configVar *float64) {
+func (p *Parameter) Initialize(value float64, configVar *float64, setup *SafeConfig) {
 	// set an initial value to a parameter
-	// update linked variable
+	// update linked variable, it is then only written with the setup locked
 	p.variable = configVar
+	p.setup = setup
 	//p.Update(value)
 	// binding
 	p.Bind = binding.NewFloat()
@@ -60,112 +64,247 @@ func (p *Parameter) CreateSlider(min, max, precision float64) {
 	p.Slider.Step = precision
 }
 
-func (p *Parameter) OnSliderChange(valueLabel *widget.Label) {
-	// update the linked variable on change and the value label
+func (p *Parameter) OnSliderChange(name string, postChange func(*Config)) {
+	// update the linked variable on change
+	// postChange (can be nil) then updates what depends on the variable, with the setup still locked
 	p.Slider.OnChangeEnded = func(v float64) {
-		p.Update(v)
-		valueLabel.SetText(p.GetStringValue())
-		valueLabel.Refresh()
-	}
-}
-
-func (p *Parameter) OnSliderChangeOther(valueLabel *widget.Label, name string, setup *Config) {
-	// update the linked variables on change and the value label
-	p.Slider.OnChangeEnded = func(v float64) {
-		p.Update(v)
-		if name == "T" {
-			setup.Dt = 1 / v
-		} else if name == "R" {
-			setup.Dx = 1 / v
-			setup.ComputeKernel()
+		p.UpdateThen(v, postChange)
+		if p.setup != nil {
+			var events *EventBus
+			var step int
+			p.setup.ReadState(func(c *Config) {
+				events, step = c.Events, c.Step
+			})
+			events.Publish(Event{Type: EventParamChange, Step: step, Name: name, Value: v})
 		}
-		valueLabel.SetText(p.GetStringValue())
-		valueLabel.Refresh()
 	}
 }
 
-func (p *Parameter) GetSliderBox(min, max, precision float64, label string, setup *Config) *fyne.Container {
+func (p *Parameter) GetSliderBox(min, max, precision float64, label string, postChange func(*Config)) *fyne.Container {
 	// generate a box containing the name of a variable, a slider and its value that is updated on slider change
+	// postChange can also update other variables (for example T updates dT=1/T)
 	text := widget.NewLabel(label)
-	valueLabel := widget.NewLabel(p.GetStringValue())
+	// the value label follows the binding
+	valueLabel := widget.NewLabelWithData(binding.FloatToStringWithFormat(p.Bind, "%.3f"))
 	p.CreateSlider(min, max, precision)
 	box := container.NewBorder(nil, nil, text, valueLabel, p.Slider)
-	if setup == nil {
-		p.OnSliderChange(valueLabel)
-	} else {
-		// also update another variable (for example T updates dT=1/T)
-		p.OnSliderChangeOther(valueLabel, label, setup)
-	}
+	p.OnSliderChange(label, postChange)
 	return box
 }
 
+func (p *Parameter) Set(value float64) {
+	// change the value from outside the slider: move the slider and update the linked variable
+	p.Bind.Set(value)
+	p.Update(value)
+}
+
 func (p *Parameter) Update(value float64) {
 	// update the parameter linked variable
-	*p.variable = value
+	p.UpdateThen(value, nil)
+}
+
+func (p *Parameter) UpdateThen(value float64, postChange func(*Config)) {
+	// update the parameter linked variable then call postChange (if not nil) in the same lock
+	if p.setup == nil {
+		*p.variable = value
+		return
+	}
+	p.setup.WriteState(func(c *Config) {
+		*p.variable = value
+		if postChange != nil {
+			postChange(c)
+		}
+	})
 }
 
 func FlagToBeta(s string) []float64 {
-	// parse the -b flag values to a float array
+	// parse the -b flag values to a float array, the invalid ones are skipped
 	var beta []float64
 	for _, value := range strings.Split(s, ",") {
-		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+		if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
 			beta = append(beta, parsed)
 		}
 	}
 	return beta
 }
 
+func FlagToBreakpoints(s string) ([]int, error) {
+	// parse the -break flag, steps separated by commas
+	var steps []int
+	for _, value := range strings.Split(s, ",") {
+		step, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("breakpoint %q is not a step number", value)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func BetaToFlag(beta []float64) string {
+	// format beta as the -b flag value
+	values := make([]string, len(beta))
+	for k, b := range beta {
+		values[k] = strconv.FormatFloat(b, 'g', -1, 64)
+	}
+	return strings.Join(values, ",")
+}
+
+func ValidateBeta(s string) ([]float64, error) {
+	// parse a beta string like FlagToBeta, failing on any invalid value
+	// each value must be a finite number between 0 and 1, spaces around them are ignored
+	var beta []float64
+	sum := 0.
+	for _, value := range strings.Split(s, ",") {
+		b, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("beta %q: values must be numbers separated by commas", s)
+		}
+		if !(b >= 0 && b <= 1) {
+			return nil, fmt.Errorf("beta %q: values must be between 0 and 1", s)
+		}
+		beta = append(beta, b)
+		sum += b
+	}
+	if sum == 0 {
+		return nil, fmt.Errorf("beta %q: at least one value must be positive", s)
+	}
+	return beta, nil
+}
+
 // colormap choice
 
 type ColormapButton struct {
-	colors  *[][]int
-	Buttons *widget.RadioGroup
+	colors     *[][]int
+	hsv        *hsvColormap
+	perceptual *perceptualColormap
+	raster     *canvas.Raster
+	setup      *SafeConfig
+	Buttons    *widget.RadioGroup
 }
 
 type ManageColormapButton interface {
 	initColormaps()
 	GetColor()
+	HSVSettings()
+	PerceptualCheck()
+}
+
+// rainbow colormap going around the hue circle, used when "HSV" is selected
+type hsvColormap struct {
+	enabled bool
+	// hue of 0 and hue range up to 1, in degrees
+	hueStart, hueRange float64
+	saturation         float64
+}
+
+// available colormaps, as color stops from 0 to 1
+var colormapNames = []string{"White", "Black", "Inferno", "Viridis", "HSV"}
+var colormaps = map[string][][]int{
+	"White": {{255, 255, 255}, {0, 0, 0}},
+	"Black": {{0, 0, 0}, {255, 255, 255}},
+	"Inferno": {
+		{0, 0, 4},
+		{87, 16, 110},
+		{188, 55, 84},
+		{249, 142, 9},
+		{252, 255, 164},
+	},
+	"Viridis": {
+		{68, 1, 84},
+		{59, 82, 139},
+		{33, 145, 140},
+		{94, 201, 98},
+		{253, 231, 37},
+	},
 }
 
 func (c *ColormapButton) initColormaps(raster *canvas.Raster) {
 	c.Buttons.OnChanged = func(value string) {
-		switch value {
-		case "White":
-			*c.colors = [][]int{{255, 255, 255}, {0, 0, 0}}
-		case "Black":
-			*c.colors = [][]int{{0, 0, 0}, {255, 255, 255}}
-		case "Inferno":
-			*c.colors = [][]int{
-				{0, 0, 4},
-				{87, 16, 110},
-				{188, 55, 84},
-				{249, 142, 9},
-				{252, 255, 164},
-			}
-		case "Viridis":
-			*c.colors = [][]int{
-				{68, 1, 84},
-				{59, 82, 139},
-				{33, 145, 140},
-				{94, 201, 98},
-				{253, 231, 37},
-			}
+		c.hsv.enabled = value == "HSV"
+		if colors, ok := colormaps[value]; ok {
+			*c.colors = colors
+			c.perceptual.lut = perceptualGradient(colors)
 		}
 		raster.Refresh()
 	}
 }
 
-func CreateColormapButton(colors *[][]int, raster *canvas.Raster) ColormapButton {
-	radio := widget.NewRadioGroup([]string{"White", "Black", "Inferno", "Viridis"}, nil)
+func CreateColormapButton(colors *[][]int, raster *canvas.Raster, setup *SafeConfig) ColormapButton {
+	// the perceptual interpolation follows the config of setup, so that it is saved with it
+	radio := widget.NewRadioGroup(colormapNames, nil)
 	cButton := ColormapButton{
-		colors:  colors,
-		Buttons: radio,
+		colors:     colors,
+		hsv:        &hsvColormap{hueStart: 0, hueRange: 300, saturation: 1},
+		perceptual: &perceptualColormap{},
+		raster:     raster,
+		setup:      setup,
+		Buttons:    radio,
 	}
+	setup.WriteState(func(c *Config) {
+		cButton.perceptual.enabled = &c.PerceptualColormap
+	})
 	cButton.initColormaps(raster)
 	cButton.Buttons.SetSelected("White")
 	return cButton
 }
 
+func (c *ColormapButton) HSVSettings() *widget.Accordion {
+	// panel with the HSV colormap sliders and a preview strip of its gradient
+	preview := canvas.NewRaster(func(w, h int) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for i := 0; i < w; i++ {
+			col := c.hsv.color(float64(i) / float64(w-1))
+			for j := 0; j < h; j++ {
+				img.Set(i, j, col)
+			}
+		}
+		return img
+	})
+	preview.SetMinSize(fyne.NewSize(0, 20))
+	slider := func(label string, min, max, step float64, variable *float64) *fyne.Container {
+		s := widget.NewSlider(min, max)
+		s.Step = step
+		s.Value = *variable
+		valueLabel := widget.NewLabel(fmt.Sprintf("%.2f", *variable))
+		s.OnChanged = func(v float64) {
+			*variable = v
+			valueLabel.SetText(fmt.Sprintf("%.2f", v))
+			preview.Refresh()
+			if c.hsv.enabled {
+				c.raster.Refresh()
+			}
+		}
+		return container.NewBorder(nil, nil, widget.NewLabel(label), valueLabel, s)
+	}
+	panel := container.NewVBox(
+		slider("Hue start", 0, 360, 1, &c.hsv.hueStart),
+		slider("Hue range", 0, 360, 1, &c.hsv.hueRange),
+		slider("Saturation", 0, 1, 0.01, &c.hsv.saturation),
+		preview)
+	return widget.NewAccordion(widget.NewAccordionItem("HSV colormap", panel))
+}
+
+func (c *ColormapButton) PerceptualCheck() *widget.Check {
+	// checkbox interpolating the gradients in CIELAB instead of RGB (no effect on HSV)
+	// it sets Config.PerceptualColormap
+	check := widget.NewCheck("Perceptual interpolation (CIELAB)", func(checked bool) {
+		c.setup.WriteState(func(*Config) {
+			*c.perceptual.enabled = checked
+		})
+		c.raster.Refresh()
+	})
+	c.setup.ReadState(func(*Config) {
+		check.Checked = *c.perceptual.enabled
+	})
+	return check
+}
+
+func (h *hsvColormap) color(v float64) color.Color {
+	// color of v (between 0 and 1) with a value of 1
+	return hsvColor(h.hueStart+h.hueRange*v, h.saturation, 1)
+}
+
 func interpolate(x float64, a, b int) uint8 {
 	// gives the value at x between a and b. x between 0 and 1
 	return uint8(float64(a) + float64(b-a)*x)
@@ -173,12 +312,25 @@ func interpolate(x float64, a, b int) uint8 {
 
 func (c *ColormapButton) GetColor(v float64) color.Color {
 	// return the color corresponding to v
-	scaledV := v * float64((len(*c.colors) - 1))
+	// the soft clip lets the state go slightly outside [0, 1]
+	v = Clip(v, 0, 1)
+	if c.hsv != nil && c.hsv.enabled {
+		return c.hsv.color(v)
+	}
+	if c.perceptual != nil && c.perceptual.enabled != nil && *c.perceptual.enabled && c.perceptual.lut != nil {
+		return c.perceptual.lut[int(v*(perceptualLevels-1))]
+	}
+	return gradientColor(*c.colors, v)
+}
+
+func gradientColor(colors [][]int, v float64) color.Color {
+	// return the color at v (between 0 and 1) of a gradient defined by color stops
+	scaledV := v * float64((len(colors) - 1))
 	index1 := int(math.Floor(scaledV))
 	index2 := int(math.Ceil(scaledV))
 	x := scaledV - float64(index1)
-	c1 := (*c.colors)[index1]
-	c2 := (*c.colors)[index2]
+	c1 := colors[index1]
+	c2 := colors[index2]
 	return color.RGBA{
 		interpolate(x, c1[0], c2[0]),
 		interpolate(x, c1[1], c2[1]),
@@ -186,3 +338,35 @@ func (c *ColormapButton) GetColor(v float64) color.Color {
 		0xff,
 	}
 }
+
+func hsvColor(h, s, v float64) color.RGBA {
+	// convert a hue (in degrees), saturation and value (between 0 and 1) to a color
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	chroma := v * s
+	x := chroma * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = chroma, x, 0
+	case h < 120:
+		r, g, b = x, chroma, 0
+	case h < 180:
+		r, g, b = 0, chroma, x
+	case h < 240:
+		r, g, b = 0, x, chroma
+	case h < 300:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+	m := v - chroma
+	return color.RGBA{
+		uint8(math.Round((r + m) * 255)),
+		uint8(math.Round((g + m) * 255)),
+		uint8(math.Round((b + m) * 255)),
+		0xff,
+	}
+}
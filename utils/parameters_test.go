@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func assertKernelOf(t *testing.T, setup *SafeConfig, R float64, beta []float64) {
+	// the kernel and its FFT are the ones of a new config with R and beta
+	t.Helper()
+	fresh, err := NewConfig(128, 128, R, 10, 0.15, 0.015, beta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setup.ReadState(func(c *Config) {
+		if !denseWithin(c.Kernel, fresh.Kernel, 1e-12) {
+			t.Errorf("stale kernel for R=%g beta=%v", R, beta)
+		}
+		if !cDenseWithin(c.KFFT, fresh.KFFT, 1e-12) {
+			t.Errorf("stale kernel FFT for R=%g beta=%v", R, beta)
+		}
+	})
+}
+
+func TestParameterChangeRecomputesKernel(t *testing.T) {
+	// changing R with its slider or Beta updates the kernel and its FFT
+	c, err := NewConfig(128, 128, 13, 10, 0.15, 0.015, []float64{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setup := NewSafeConfig(c)
+	var R Parameter
+	setup.WriteState(func(c *Config) {
+		R.Initialize(c.R, &c.R, setup)
+	})
+	// like the slider callback of the simulation
+	done := make(chan struct{})
+	R.UpdateThen(20, func(*Config) {
+		setup.ComputeKernelAsync(done)
+	})
+	<-done
+	assertKernelOf(t, setup, 20, []float64{1})
+	setup.WriteState(func(c *Config) {
+		c.Beta = []float64{1, 0.5}
+		c.ComputeKernel()
+	})
+	assertKernelOf(t, setup, 20, []float64{1, 0.5})
+}
+
+func TestValidateBeta(t *testing.T) {
+	// finite values between 0 and 1 pass, spaces included, anything else fails
+	valid := map[string][]float64{
+		"1":            {1},
+		"1,0.5":        {1, 0.5},
+		"1, 0.5, 0.25": {1, 0.5, 0.25},
+		" 0 ,1 ":       {0, 1},
+	}
+	for s, want := range valid {
+		beta, err := ValidateBeta(s)
+		if err != nil {
+			t.Fatalf("%q: %v", s, err)
+		}
+		if !slices.Equal(beta, want) {
+			t.Fatalf("%q gives %v, want %v", s, beta, want)
+		}
+	}
+	for _, s := range []string{"", "1,", "a", "NaN", "1,Inf", "-Inf", "1.5", "-0.1", "0,0"} {
+		if _, err := ValidateBeta(s); err == nil {
+			t.Fatalf("%q is accepted", s)
+		}
+	}
+}
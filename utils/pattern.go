@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"gonum.org/v1/gonum/mat"
+)
+
+func occupiedSpan(occupied []bool) (start, length int) {
+	// smallest cyclic interval containing all the true indexes, found as the complement of the largest empty gap
+	n := len(occupied)
+	gapStart, gapLength := 0, 0
+	for k := 0; k < n; k++ {
+		// measure the empty gap starting at k only if it starts right after an occupied index
+		if occupied[k] || !occupied[mod(k-1, n)] {
+			continue
+		}
+		l := 0
+		for l < n && !occupied[(k+l)%n] {
+			l++
+		}
+		if l > gapLength {
+			gapStart, gapLength = k, l
+		}
+	}
+	return (gapStart + gapLength) % n, n - gapLength
+}
+
+func BoundingBox(c *Config, threshold float64) (x, y, w, h int) {
+	// smallest rectangle containing all the cells above threshold, (x, y) being its corner
+	// the world wraps around so the rectangle can cross the edges, (0, 0, 0, 0) when there is no cell
+	rows, cols := c.A.Dims()
+	occupiedX := make([]bool, rows)
+	occupiedY := make([]bool, cols)
+	found := false
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			if c.A.At(i, j) > threshold {
+				occupiedX[i] = true
+				occupiedY[j] = true
+				found = true
+			}
+		}
+	}
+	if !found {
+		return 0, 0, 0, 0
+	}
+	x, w = occupiedSpan(occupiedX)
+	y, h = occupiedSpan(occupiedY)
+	return x, y, w, h
+}
+
+func CenterPattern(c *Config, threshold float64) {
+	// shift the state so that the bounding box of the cells above threshold is centered in the world
+	x, y, w, h := BoundingBox(c, threshold)
+	if w == 0 {
+		return
+	}
+	rows, cols := c.A.Dims()
+	c.A = cyclicShift(c.A, rows/2-(x+w/2), cols/2-(y+h/2))
+}
+
+func CopyRegion(c *Config, x, y, w, h int) *mat.Dense {
+	// copy of the w*h region of the state starting at (x, y), wrapping around the world
+	rows, cols := c.A.Dims()
+	region := mat.NewDense(w, h, nil)
+	region.Apply(func(i, j int, _ float64) float64 {
+		return c.A.At(mod(x+i, rows), mod(y+j, cols))
+	}, region)
+	return region
+}
+
+func PasteRegion(c *Config, data *mat.Dense, x, y int) {
+	// write a region copied with CopyRegion into the state at (x, y), wrapping around the world
+	rows, cols := c.A.Dims()
+	w, h := data.Dims()
+	for i := 0; i < w; i++ {
+		for j := 0; j < h; j++ {
+			c.A.Set(mod(x+i, rows), mod(y+j, cols), data.At(i, j))
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"runtime"
+	"sync"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// result of one run of a phase portrait
+type PhaseCell struct {
+	I, J             int
+	Mu, Sigma, Value float64
+}
+
+func PhasePortrait(c *Config, muRange, sigmaRange [2]float64, gridN, steps int, metric func(*Config) float64) *mat.Dense {
+	// run the simulation for each (Mu, Sigma) pair of a gridN x gridN grid, all from the state of c,
+	// and return the metric after the given number of steps (indexed by (mu, sigma))
+	result := mat.NewDense(gridN, gridN, nil)
+	cells := make(chan PhaseCell)
+	go PhasePortraitAsync(c, muRange, sigmaRange, gridN, steps, metric, cells, nil)
+	for cell := range cells {
+		result.Set(cell.I, cell.J, cell.Value)
+	}
+	return result
+}
+
+func PhasePortraitAsync(c *Config, muRange, sigmaRange [2]float64, gridN, steps int, metric func(*Config) float64, cells chan<- PhaseCell, stop <-chan struct{}) {
+	// same as PhasePortrait but each result is sent to cells as soon as it is computed
+	// cells is closed when all runs are done, or early once stop (can be nil) is closed
+	defer close(cells)
+	jobs := make(chan [2]int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				// the kernel does not depend on Mu and Sigma so it can be shared
+				run := c.Clone()
+				run.Mu = GridValue(muRange, job[0], gridN)
+				run.Sigma = GridValue(sigmaRange, job[1], gridN)
+				for s := 0; s < steps; s++ {
+					run.Update()
+				}
+				select {
+				case cells <- PhaseCell{I: job[0], J: job[1], Mu: run.Mu, Sigma: run.Sigma, Value: metric(&run)}:
+				case <-stop:
+				}
+			}
+		}()
+	}
+feed:
+	for i := 0; i < gridN; i++ {
+		for j := 0; j < gridN; j++ {
+			select {
+			case jobs <- [2]int{i, j}:
+			case <-stop:
+				break feed
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func SavePhasePortrait(m *mat.Dense, muRange, sigmaRange [2]float64, path string) error {
+	// save a phase portrait as a heatmap with Mu along x and Sigma along y
+	return SaveHeatmap(m, path, "Mu", "Sigma", muRange, sigmaRange)
+}
+
+func GridValue(bounds [2]float64, k, n int) float64 {
+	// k-th of n values evenly spread between the bounds (included)
+	if n < 2 {
+		return bounds[0]
+	}
+	return bounds[0] + (bounds[1]-bounds[0])*float64(k)/float64(n-1)
+}
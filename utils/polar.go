@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/mjibson/go-dsp/fft"
+	"gonum.org/v1/gonum/mat"
+)
+
+// a disk shaped world on a polar grid: row i of A is the ring of radius i+0.5 (in cells)
+// and column j the sector at the angle 2πj/Ntheta, so the cells get wider away from the center
+// the embedded config holds the parameters, its A is the Nr x Ntheta state
+type PolarConfig struct {
+	Config
+	Nr, Ntheta int
+	// for each ring, the kernel towards the rings within R
+	rings [][]polarKernel
+}
+
+// weights of the cells of ring i2 around a cell, as the FFT along the angle
+// the kernel does not depend on the sector, so the potential is a sum of 1D circular convolutions
+type polarKernel struct {
+	i2   int
+	kfft []complex128
+}
+type ManagePolarConfig interface {
+	ComputeKernel()
+	InitState()
+	Potential()
+	Update()
+	AtPoint()
+}
+
+func NewPolarConfig(Nr, Ntheta int, R, T, Mu, Sigma float64, Beta []float64) PolarConfig {
+	// create a polar world with the same parameters as a config, R being in radial cells
+	c := PolarConfig{
+		Config: Config{
+			A:     mat.NewDense(Nr, Ntheta, nil),
+			T:     T,
+			R:     R,
+			Mu:    Mu,
+			Sigma: Sigma,
+			Beta:  Beta,
+			Seed:  time.Now().UnixNano(),
+
+			ClipSteepness: DefaultClipSteepness,
+			FFTPadFactor:  1,
+			KernelAspect:  1,
+		},
+		Nr:     Nr,
+		Ntheta: Ntheta,
+	}
+	c.Dt = 1 / T
+	c.ComputeKernel()
+	c.InitState()
+	return c
+}
+
+func (c *PolarConfig) ComputeKernel() {
+	// kernel of each ring within R, with the euclidean distance between the cell centers
+	// a neighbor weighs the kernel at its distance times its area (r dr dθ),
+	// normalized for each ring so that the potential stays an average
+	c.Dx = 1 / c.R
+	dtheta := 2 * math.Pi / float64(c.Ntheta)
+	lenBeta := float64(len(c.Beta))
+	c.rings = make([][]polarKernel, c.Nr)
+	for i := range c.rings {
+		r1 := float64(i) + 0.5
+		var weights [][]float64
+		var neighbors []int
+		sum := 0.
+		for i2 := max(0, i-int(c.R)); i2 < c.Nr && i2 <= i+int(c.R); i2++ {
+			r2 := float64(i2) + 0.5
+			w := make([]float64, c.Ntheta)
+			ringSum := 0.
+			for dj := range w {
+				d := math.Sqrt(math.Max(0, r1*r1+r2*r2-2*r1*r2*math.Cos(float64(dj)*dtheta)))
+				w[dj] = c.kernelShell(d*lenBeta/c.R) * r2 * dtheta
+				ringSum += w[dj]
+			}
+			if ringSum > 0 {
+				weights = append(weights, w)
+				neighbors = append(neighbors, i2)
+				sum += ringSum
+			}
+		}
+		for k, w := range weights {
+			for dj := range w {
+				w[dj] /= sum
+			}
+			c.rings[i] = append(c.rings[i], polarKernel{neighbors[k], fft.FFTReal(w)})
+		}
+	}
+}
+
+func (c *PolarConfig) InitState() {
+	// rotationally symmetric start: random rings in the inner half of the disk,
+	// with a little angular noise so that the symmetry can break
+	r := c.random()
+	c.A.Zero()
+	for i := 0; i < c.Nr/2; i++ {
+		if r.Float64() < 0.5 {
+			continue
+		}
+		v := r.Float64()
+		for j := 0; j < c.Ntheta; j++ {
+			c.A.Set(i, j, Clip(v*(0.95+0.1*r.Float64()), 0, 1))
+		}
+	}
+}
+
+func (c *PolarConfig) Potential() *mat.Dense {
+	// convolution of the state with the polar kernel, the world wraps around in angle only
+	// the kernel is symmetric in angle so the convolution along it is done with FFTs, rings are split between goroutines
+	rowsFFT := make([][]complex128, c.Nr)
+	for i := range rowsFFT {
+		rowsFFT[i] = fft.FFTReal(c.A.RawRowView(i))
+	}
+	U := mat.NewDense(c.Nr, c.Ntheta, nil)
+	rings := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sum := make([]complex128, c.Ntheta)
+			for i := range rings {
+				for j := range sum {
+					sum[j] = 0
+				}
+				for _, k := range c.rings[i] {
+					for j, z := range k.kfft {
+						sum[j] += z * rowsFFT[k.i2][j]
+					}
+				}
+				// each goroutine writes its own rows
+				for j, z := range fft.IFFT(sum) {
+					U.Set(i, j, real(z))
+				}
+			}
+		}()
+	}
+	for i := 0; i < c.Nr; i++ {
+		rings <- i
+	}
+	close(rings)
+	wg.Wait()
+	return U
+}
+
+func (c *PolarConfig) Update() {
+	// compute the next state
+	c.Grow(c.Potential())
+	c.Step++
+}
+
+func (c *PolarConfig) AtPoint(x, y float64) (float64, bool) {
+	// value of the cell holding the point (x, y), in radial cells from the center of the disk
+	// false outside of the disk
+	i := int(math.Hypot(x, y))
+	if i >= c.Nr {
+		return 0, false
+	}
+	theta := math.Atan2(y, x)
+	if theta < 0 {
+		theta += 2 * math.Pi
+	}
+	j := int(theta/(2*math.Pi)*float64(c.Ntheta)) % c.Ntheta
+	return c.A.At(i, j), true
+}
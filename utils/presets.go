@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+)
+
+// named parameters of a creature, run from a fixed seed
+type Preset struct {
+	Name string `toml:"name"`
+	Seed int64  `toml:"seed"`
+	Params
+}
+
+func LoadPresets(path string) ([]Preset, error) {
+	// read the [[preset]] tables of a TOML file, missing keys keep their default value
+	var file struct {
+		Preset []toml.Primitive `toml:"preset"`
+	}
+	md, err := toml.DecodeFile(path, &file)
+	if err != nil {
+		return nil, err
+	}
+	presets := make([]Preset, len(file.Preset))
+	for k, primitive := range file.Preset {
+		presets[k] = Preset{Name: fmt.Sprintf("preset %d", k+1), Params: DefaultParams()}
+		if err := md.PrimitiveDecode(primitive, &presets[k]); err != nil {
+			return nil, err
+		}
+		if err := presets[k].Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", presets[k].Name, err)
+		}
+	}
+	return presets, nil
+}
+
+func ComparePresets(presets []Preset, steps int, metrics []string) ([]map[string]float64, error) {
+	// run every preset for steps steps, one run per CPU at a time, and return its metrics at the end
+	// unknown metric names are ignored, the runs start only if every preset is valid
+	for _, preset := range presets {
+		if err := preset.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", preset.Name, err)
+		}
+	}
+	results := make([]map[string]float64, len(presets))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range indexes {
+				// the presets are validated above
+				c, _ := presets[k].NewConfig(presets[k].Seed)
+				for s := 0; s < steps; s++ {
+					c.Update()
+				}
+				results[k] = map[string]float64{}
+				for _, name := range metrics {
+					if metric, ok := Metrics[name]; ok {
+						results[k][name] = metric(&c)
+					}
+				}
+			}
+		}()
+	}
+	for k := range presets {
+		indexes <- k
+	}
+	close(indexes)
+	wg.Wait()
+	return results, nil
+}
+
+func PresetsTable(presets []Preset, metrics []string, results []map[string]float64) string {
+	// markdown table with one line per preset and one column per metric
+	var b strings.Builder
+	b.WriteString("| preset |")
+	for _, name := range metrics {
+		fmt.Fprintf(&b, " %s |", name)
+	}
+	b.WriteString("\n|---|")
+	b.WriteString(strings.Repeat("---|", len(metrics)))
+	b.WriteString("\n")
+	for k, p := range presets {
+		fmt.Fprintf(&b, "| %s |", p.Name)
+		for _, name := range metrics {
+			fmt.Fprintf(&b, " %.4g |", results[k][name])
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func PresetsTOML(presets []Preset) (string, error) {
+	// [[preset]] tables of the presets, as read by LoadPresets
+	var b bytes.Buffer
+	err := toml.NewEncoder(&b).Encode(struct {
+		Preset []Preset `toml:"preset"`
+	}{presets})
+	return b.String(), err
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestComparePresetsOrder(t *testing.T) {
+	// each result belongs to its preset, whatever the scheduling
+	var presets []Preset
+	for k := 0; k < 5; k++ {
+		presets = append(presets, Preset{
+			Name:   fmt.Sprintf("preset %d", k),
+			Seed:   int64(k),
+			Params: Params{Width: 128, Height: 128, R: 13, T: 10, Mu: 0.15, Sigma: 0.015, Beta: []float64{1}},
+		})
+	}
+	results, err := ComparePresets(presets, 2, []string{"mean"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, preset := range presets {
+		c, err := preset.NewConfig(preset.Seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Update()
+		c.Update()
+		if want := MeanState(&c); results[k]["mean"] != want {
+			t.Fatalf("%s: mean %g, want %g", preset.Name, results[k]["mean"], want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/widget"
+	"gonum.org/v1/gonum/floats"
+)
+
+// distance to the outer edge (in canvas units) where a drag resizes the kernel
+const ringHandleWidth = 8
+
+// the kernel is computed once the drag events stop for this long
+const ringDebounce = 50 * time.Millisecond
+
+const (
+	ringDragNone = iota
+	ringDragRadius
+	ringDragWeight
+)
+
+// the kernel rings drawn as concentric annuli, one per beta element, brighter with their weight
+// clicking on a ring selects it, dragging vertically then changes its weight
+// and dragging the outer edge changes R
+// the kernel is computed in the background once the drag pauses, then EventParams is published
+// on the events of the config
+type KernelRingEditor struct {
+	widget.BaseWidget
+	// largest R, reached when the kernel fills the widget
+	MaxR     float64
+	setup    *SafeConfig
+	raster   *canvas.Raster
+	selected int
+	dragMode int
+	// pending kernel computation, restarted by each drag event
+	debounce *time.Timer
+}
+
+type ManageKernelRingEditor interface {
+	Tapped()
+	Dragged()
+	DragEnd()
+}
+
+func NewKernelRingEditor(setup *SafeConfig, maxR float64) *KernelRingEditor {
+	// create an editor of the kernel of setup
+	e := &KernelRingEditor{MaxR: maxR, setup: setup, selected: -1}
+	e.raster = canvas.NewRaster(e.render)
+	e.raster.SetMinSize(fyne.NewSize(200, 200))
+	e.ExtendBaseWidget(e)
+	return e
+}
+
+func (e *KernelRingEditor) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(e.raster)
+}
+
+func (e *KernelRingEditor) render(w, h int) image.Image {
+	// draw each ring in red with its weight as brightness, the selected one in cyan
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	var R float64
+	var beta []float64
+	e.setup.ReadState(func(c *Config) {
+		R, beta = c.R, append([]float64(nil), c.Beta...)
+	})
+	half := math.Min(float64(w), float64(h)) / 2
+	outer := half * R / e.MaxR
+	for i := 0; i < w; i++ {
+		for j := 0; j < h; j++ {
+			d := math.Hypot(float64(i)-float64(w)/2, float64(j)-float64(h)/2)
+			if d >= outer || len(beta) == 0 {
+				img.Set(i, j, color.Black)
+				continue
+			}
+			k := int(d / outer * float64(len(beta)))
+			v := uint8(64 + 191*Clip(beta[k], 0, 1))
+			if k == e.selected {
+				img.Set(i, j, color.RGBA{0, v, v, 0xff})
+			} else {
+				img.Set(i, j, color.RGBA{v, 0, 0, 0xff})
+			}
+			// outer edge as the resize handle
+			if outer-d < 2 {
+				img.Set(i, j, color.White)
+			}
+		}
+	}
+	return img
+}
+
+func (e *KernelRingEditor) geometry(p fyne.Position) (d, outer float64, beta []float64, R float64) {
+	// distance of a position to the center and outer radius of the kernel, in canvas units
+	size := e.Size()
+	d = math.Hypot(float64(p.X-size.Width/2), float64(p.Y-size.Height/2))
+	e.setup.ReadState(func(c *Config) {
+		R, beta = c.R, append([]float64(nil), c.Beta...)
+	})
+	outer = math.Min(float64(size.Width), float64(size.Height)) / 2 * R / e.MaxR
+	return d, outer, beta, R
+}
+
+func (e *KernelRingEditor) Tapped(ev *fyne.PointEvent) {
+	// select the ring under the mouse, or none outside the kernel
+	d, outer, beta, _ := e.geometry(ev.Position)
+	e.selected = -1
+	if d < outer && len(beta) > 0 {
+		e.selected = int(d / outer * float64(len(beta)))
+	}
+	e.raster.Refresh()
+}
+
+func (e *KernelRingEditor) Dragged(ev *fyne.DragEvent) {
+	// resize the kernel from its edge or change the weight of the selected ring
+	if e.dragMode == ringDragNone {
+		start := ev.Position.Subtract(ev.Dragged)
+		d, outer, _, _ := e.geometry(start)
+		if math.Abs(d-outer) < ringHandleWidth {
+			e.dragMode = ringDragRadius
+		} else if e.selected >= 0 {
+			e.dragMode = ringDragWeight
+		} else {
+			return
+		}
+	}
+	var R float64
+	var beta []float64
+	var events *EventBus
+	if e.dragMode == ringDragRadius {
+		d, _, _, _ := e.geometry(ev.Position)
+		size := e.Size()
+		R = math.Round(Clip(d/(math.Min(float64(size.Width), float64(size.Height))/2)*e.MaxR, 2, e.MaxR))
+	}
+	e.setup.WriteState(func(c *Config) {
+		if e.dragMode == ringDragRadius {
+			c.R = R
+		} else if e.selected < len(c.Beta) {
+			// dragging up increases the weight, the whole height going from 0 to 1
+			// beta is replaced as its slice can be shared with copies of the config
+			beta := append([]float64(nil), c.Beta...)
+			beta[e.selected] = Clip(beta[e.selected]-float64(ev.Dragged.DY/e.Size().Height), 0, 1)
+			// a kernel without any ring can not be normalized
+			if floats.Sum(beta) > 0 {
+				c.Beta = beta
+			}
+		}
+		R, beta = c.R, append([]float64(nil), c.Beta...)
+		events = c.Events
+	})
+	e.raster.Refresh()
+	if e.debounce != nil {
+		e.debounce.Stop()
+	}
+	e.debounce = time.AfterFunc(ringDebounce, func() {
+		done := make(chan struct{})
+		e.setup.ComputeKernelAsync(done)
+		<-done
+		events.Publish(Event{Type: EventParams, Value: R, Beta: beta})
+	})
+}
+
+func (e *KernelRingEditor) DragEnd() {
+	e.dragMode = ringDragNone
+}
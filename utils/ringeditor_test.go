@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/test"
+)
+
+func TestRingEditorDebounce(t *testing.T) {
+	// a burst of drag events gives a single kernel computation, done after the last one
+	test.NewApp()
+	c := newTestConfig(t, 128, 1)
+	c.Beta = []float64{1, 1}
+	c.ComputeKernel()
+	c.Events = NewEventBus()
+	published := make(chan Event, 10)
+	c.Events.Subscribe(EventParams, func(e Event) {
+		published <- e
+	})
+	setup := NewSafeConfig(c)
+	editor := NewKernelRingEditor(setup, 20)
+	editor.Resize(fyne.NewSize(200, 200))
+	// select the outer ring, then drag it down by 5% ten times
+	editor.Tapped(&fyne.PointEvent{Position: fyne.NewPos(100, 100+0.75*13/20*100)})
+	for k := 0; k < 10; k++ {
+		editor.Dragged(&fyne.DragEvent{PointEvent: fyne.PointEvent{Position: fyne.NewPos(100, 190)}, Dragged: fyne.NewDelta(0, 10)})
+	}
+	editor.DragEnd()
+	var beta []float64
+	select {
+	case e := <-published:
+		// the drag is in float32 canvas units
+		if e.Value != 13 || len(e.Beta) != 2 || math.Abs(e.Beta[1]-0.5) > 1e-6 {
+			t.Fatalf("published R=%g beta=%v, want R=13 beta=[1 0.5]", e.Value, e.Beta)
+		}
+		beta = e.Beta
+	case <-time.After(5 * time.Second):
+		t.Fatal("the kernel change is not published")
+	}
+	select {
+	case <-published:
+		t.Fatal("the drag events are not merged")
+	case <-time.After(4 * ringDebounce):
+	}
+	assertKernelOf(t, setup, 13, beta)
+}
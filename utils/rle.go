@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// values are quantized to 16 bits, far below what is visible in a state
+const rleLevels = math.MaxUint16
+
+func RLEEncode(m *mat.Dense) []byte {
+	// run-length encode a matrix with values between 0 and 1, in row-major order
+	// layout: rows and columns as uvarints, then runs of (length uvarint, value uint16)
+	r, c := m.Dims()
+	b := binary.AppendUvarint(nil, uint64(r))
+	b = binary.AppendUvarint(b, uint64(c))
+	var current uint16
+	run := 0
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			q := uint16(math.Round(Clip(m.At(i, j), 0, 1) * rleLevels))
+			if run > 0 && q == current {
+				run++
+				continue
+			}
+			if run > 0 {
+				b = binary.AppendUvarint(b, uint64(run))
+				b = binary.LittleEndian.AppendUint16(b, current)
+			}
+			current, run = q, 1
+		}
+	}
+	if run > 0 {
+		b = binary.AppendUvarint(b, uint64(run))
+		b = binary.LittleEndian.AppendUint16(b, current)
+	}
+	return b
+}
+
+func RLEDecode(b []byte) (*mat.Dense, error) {
+	// decode a matrix written by RLEEncode
+	r, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, errors.New("rle: invalid row count")
+	}
+	b = b[n:]
+	c, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, errors.New("rle: invalid column count")
+	}
+	b = b[n:]
+	if r == 0 || c == 0 || r > math.MaxInt32 || c > math.MaxInt32 {
+		return nil, errors.New("rle: invalid dimensions")
+	}
+	// the slice grows with the runs so a corrupted header can not allocate a huge matrix
+	var data []float64
+	for len(b) > 0 {
+		run, n := binary.Uvarint(b)
+		if n <= 0 || len(b) < n+2 {
+			return nil, errors.New("rle: truncated run")
+		}
+		if run == 0 || run > r*c-uint64(len(data)) {
+			return nil, errors.New("rle: invalid run length")
+		}
+		v := float64(binary.LittleEndian.Uint16(b[n:])) / rleLevels
+		for k := uint64(0); k < run; k++ {
+			data = append(data, v)
+		}
+		b = b[n+2:]
+	}
+	if uint64(len(data)) != r*c {
+		return nil, errors.New("rle: missing values")
+	}
+	return mat.NewDense(int(r), int(c), data), nil
+}
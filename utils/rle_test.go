@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func evolvedState(t testing.TB, size, steps int) *mat.Dense {
+	// state of an orbium-like run after steps steps
+	c := newTestConfig(t, size, 1)
+	for step := 0; step < steps; step++ {
+		c.Update()
+	}
+	return c.A
+}
+
+func TestRLERoundTrip(t *testing.T) {
+	// decoding gives the state back within the 16-bit quantization
+	state := evolvedState(t, 128, 20)
+	decoded, err := RLEDecode(RLEEncode(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mat.EqualApprox(state, decoded, 0.5/rleLevels) {
+		t.Fatal("the decoded state differs from the encoded one")
+	}
+}
+
+func BenchmarkRLE(b *testing.B) {
+	// encoding and decoding speed, with the size of the encoded state over the raw float64 one
+	for _, size := range []int{128, 256, 512} {
+		state := evolvedState(b, size, 50)
+		encoded := RLEEncode(state)
+		ratio := float64(len(encoded)) / float64(8*size*size)
+		b.Run(fmt.Sprintf("encode/%dx%d", size, size), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				RLEEncode(state)
+			}
+			b.ReportMetric(ratio, "size-ratio")
+		})
+		b.Run(fmt.Sprintf("decode/%dx%d", size, size), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if _, err := RLEDecode(encoded); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// a config shared between goroutines, every access goes through a lock
+type SafeConfig struct {
+	lock   sync.RWMutex
+	config Config
+	// number of ComputeKernelAsync calls, only the last one swaps its kernel in
+	kernelGeneration atomic.Int64
+}
+
+type ManageSafeConfig interface {
+	ReadState()
+	WriteState()
+	ComputeKernelAsync()
+}
+
+func NewSafeConfig(c Config) *SafeConfig {
+	// wrap a config, it should not be used directly anymore
+	return &SafeConfig{config: c}
+}
+
+func (s *SafeConfig) ReadState(read func(*Config)) {
+	// give a read only access to the config, several readers can run at the same time
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	read(&s.config)
+}
+
+func (s *SafeConfig) WriteState(write func(*Config)) {
+	// give an exclusive access to the config
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	write(&s.config)
+}
+
+func (s *SafeConfig) ComputeKernelAsync(done chan struct{}) {
+	// compute the kernel of the current parameters in a goroutine, so that the caller does not wait for it
+	// the config is only locked to read the parameters and to swap the new kernel in,
+	// so it can be called with the config locked (the parameters are read once it is released)
+	// done is closed when the kernel is swapped in, or dropped because the kernel changed meanwhile
+	generation := s.kernelGeneration.Add(1)
+	go func() {
+		defer close(done)
+		var params Config
+		s.ReadState(func(c *Config) {
+			params = *c
+			params.Beta = append([]float64(nil), c.Beta...)
+		})
+		if s.kernelGeneration.Load() != generation {
+			return
+		}
+		K, KFFT := params.newKernel()
+		s.WriteState(func(c *Config) {
+			// a newer call or a synchronous ComputeKernel (also done when the state size changes) has the latest parameters
+			if s.kernelGeneration.Load() != generation || c.kernelVersion != params.kernelVersion {
+				return
+			}
+			c.Dx = 1 / params.R
+			c.setKernel(K, KFFT)
+		})
+	}()
+}
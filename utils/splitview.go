@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"image"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+)
+
+// the same state drawn side by side with two colormaps, each chosen below its panel
+type SplitColormapView struct {
+	Container         *fyne.Container
+	setup             *SafeConfig
+	left, right       *canvas.Raster
+	leftColors        [][]int
+	rightColors       [][]int
+	leftMap, rightMap ColormapButton
+}
+
+type ManageSplitColormapView interface {
+	Refresh()
+}
+
+func NewSplitColormapView(setup *SafeConfig) *SplitColormapView {
+	// build the two panels reading the state of setup
+	v := &SplitColormapView{setup: setup}
+	v.left = canvas.NewRaster(func(w, h int) image.Image {
+		return v.render(w, h, &v.leftMap)
+	})
+	v.right = canvas.NewRaster(func(w, h int) image.Image {
+		return v.render(w, h, &v.rightMap)
+	})
+	v.leftMap = CreateColormapButton(&v.leftColors, v.left, setup)
+	v.rightMap = CreateColormapButton(&v.rightColors, v.right, setup)
+	v.rightMap.Buttons.SetSelected("Inferno")
+	v.Container = container.New(layout.NewGridLayout(2),
+		container.NewBorder(nil, v.leftMap.Buttons, nil, nil, v.left),
+		container.NewBorder(nil, v.rightMap.Buttons, nil, nil, v.right))
+	return v
+}
+
+func (v *SplitColormapView) render(w, h int, cm *ColormapButton) image.Image {
+	// draw the state with a colormap, with setup locked for the whole image
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	v.setup.ReadState(func(c *Config) {
+		rows, cols := c.A.Dims()
+		for i := 0; i < w && i < rows; i++ {
+			for j := 0; j < h && j < cols; j++ {
+				img.Set(i, j, cm.GetColor(Clip(c.A.At(i, j), 0, 1)))
+			}
+		}
+	})
+	return img
+}
+
+func (v *SplitColormapView) Refresh() {
+	// draw both panels again, after an update of the state
+	v.left.Refresh()
+	v.right.Refresh()
+}
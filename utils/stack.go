@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"sync"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// a pile of 2D worlds coupled along a third axis z
+type Stack3D struct {
+	Slices []Config
+	// fraction of the adjacent slices states added to the potential
+	Coupling float64
+}
+
+type ManageStack3D interface {
+	Update()
+	At()
+}
+
+func NewStack3D(base *Config, n int, coupling float64) Stack3D {
+	// create n slices sharing the parameters and kernel of base, each with its own random state
+	s := Stack3D{Slices: make([]Config, n), Coupling: coupling}
+	h, w := base.A.Dims()
+	for z := range s.Slices {
+		s.Slices[z] = base.Clone()
+		s.Slices[z].SetSeed(base.Seed + int64(z) + 1)
+		s.Slices[z].A = mat.NewDense(h, w, nil)
+		s.Slices[z].InitState()
+	}
+	return s
+}
+
+func (s *Stack3D) Update() {
+	// compute the next state of every slice
+	n := len(s.Slices)
+	potentials := make([]*mat.Dense, n)
+	var wg sync.WaitGroup
+	// the potentials only depend on the current states so slices can run in parallel
+	for z := range s.Slices {
+		wg.Add(1)
+		go func(z int) {
+			defer wg.Done()
+			potentials[z] = s.Slices[z].Potential()
+		}(z)
+	}
+	wg.Wait()
+	// add the vertical coupling with the slices above and below (no wrap around in z)
+	for z := range s.Slices {
+		if z > 0 {
+			potentials[z].Add(potentials[z], scaled(s.Coupling, s.Slices[z-1].A))
+		}
+		if z < n-1 {
+			potentials[z].Add(potentials[z], scaled(s.Coupling, s.Slices[z+1].A))
+		}
+	}
+	for z := range s.Slices {
+		wg.Add(1)
+		go func(z int) {
+			defer wg.Done()
+			s.Slices[z].Grow(potentials[z])
+		}(z)
+	}
+	wg.Wait()
+}
+
+func (s *Stack3D) At(x, y, z int) float64 {
+	// value of a cell of the stack
+	return s.Slices[z].A.At(x, y)
+}
+
+func scaled(f float64, m *mat.Dense) *mat.Dense {
+	// a scaled copy of a matrix
+	r, c := m.Dims()
+	result := mat.NewDense(r, c, nil)
+	result.Scale(f, m)
+	return result
+}
@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// name of the database/sql driver, registered by modernc.org/sqlite when built with the sqlite tag
+const statsDriver = "sqlite"
+
+// the recorded rows are written in one transaction when this number is buffered, or after statsFlushInterval
+const statsBatchSize = 500
+
+const statsFlushInterval = time.Second
+
+// metrics of a step stored in the stats database
+type RunMetrics struct {
+	Mean, Variance, Entropy float64
+	Components              int
+}
+
+// selects the rows of a query, zero values select everything
+type Filter struct {
+	RunID            string
+	MinStep, MaxStep int
+}
+
+// one row of the stats database, Params is the JSON of the run parameters
+type RunRow struct {
+	RunID                   string
+	Step                    int
+	Mean, Variance, Entropy float64
+	Components              int
+	Params                  string
+}
+
+// SQLite database of the metrics of every step of every run, for analysis across runs
+// the rows are buffered and written in batches by a goroutine, so that recording does not wait for the disk
+type StatsDB struct {
+	db *sql.DB
+	// rows waiting to be written, closed by Close
+	rows chan RunRow
+	// first write error, sent by the writer when it stops
+	done chan error
+}
+
+type ManageStatsDB interface {
+	Open()
+	Record()
+	Query()
+	Close()
+}
+
+func NewRunID() string {
+	// random version 4 UUID naming a run
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func MeasureRun(c *Config, threshold float64) RunMetrics {
+	// metrics of the current state, components are counted above threshold
+	components, _ := CountComponents(c, threshold)
+	return RunMetrics{
+		Mean:       MeanState(c),
+		Variance:   VarianceState(c),
+		Entropy:    Entropy(c),
+		Components: components,
+	}
+}
+
+func (s *StatsDB) Open(path string) error {
+	// open (or create) the database file and its table
+	db, err := sql.Open(statsDriver, path)
+	if err != nil {
+		return fmt.Errorf("stats database: %w (build with -tags sqlite)", err)
+	}
+	// a step can be recorded several times in a run after a restart or a step back,
+	// the rows are kept in their recording order by seq
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS stats (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		run_id TEXT NOT NULL,
+		step INTEGER NOT NULL,
+		mean REAL,
+		variance REAL,
+		entropy REAL,
+		components INTEGER,
+		params TEXT
+	)`)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	s.db = db
+	s.rows = make(chan RunRow, 4*statsBatchSize)
+	s.done = make(chan error, 1)
+	go s.write()
+	return nil
+}
+
+func (s *StatsDB) write() {
+	// write the buffered rows in batches until the rows channel is closed
+	var batch []RunRow
+	var firstErr error
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.insert(batch); err != nil {
+			slog.Warn("stats not recorded", "rows", len(batch), "err", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		batch = batch[:0]
+	}
+	ticker := time.NewTicker(statsFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case row, ok := <-s.rows:
+			if !ok {
+				flush()
+				s.done <- firstErr
+				return
+			}
+			batch = append(batch, row)
+			if len(batch) >= statsBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (s *StatsDB) insert(rows []RunRow) error {
+	// insert rows in a single transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	insert, err := tx.Prepare(`INSERT INTO stats (run_id, step, mean, variance, entropy, components, params) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer insert.Close()
+	for _, r := range rows {
+		if _, err := insert.Exec(r.RunID, r.Step, r.Mean, r.Variance, r.Entropy, r.Components, r.Params); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *StatsDB) Record(runID string, step int, c *Config, metrics RunMetrics) error {
+	// buffer the metrics of a step with the parameters of the config, they are written later in a batch
+	// write errors are logged and returned by Close
+	if s.db == nil {
+		return errors.New("stats database not open")
+	}
+	h, w := c.A.Dims()
+	params, err := json.Marshal(Params{Width: w, Height: h, R: c.R, T: c.T, Mu: c.Mu, Sigma: c.Sigma, Beta: c.Beta})
+	if err != nil {
+		return err
+	}
+	s.rows <- RunRow{
+		RunID:      runID,
+		Step:       step,
+		Mean:       metrics.Mean,
+		Variance:   metrics.Variance,
+		Entropy:    metrics.Entropy,
+		Components: metrics.Components,
+		Params:     string(params),
+	}
+	return nil
+}
+
+func (s *StatsDB) Query(filter Filter) ([]RunRow, error) {
+	// rows matching the filter, ordered by run and recording order
+	// the rows still buffered are not returned
+	if s.db == nil {
+		return nil, errors.New("stats database not open")
+	}
+	query := `SELECT run_id, step, mean, variance, entropy, components, params FROM stats WHERE 1 = 1`
+	var args []any
+	if filter.RunID != "" {
+		query += ` AND run_id = ?`
+		args = append(args, filter.RunID)
+	}
+	if filter.MinStep > 0 {
+		query += ` AND step >= ?`
+		args = append(args, filter.MinStep)
+	}
+	if filter.MaxStep > 0 {
+		query += ` AND step <= ?`
+		args = append(args, filter.MaxStep)
+	}
+	rows, err := s.db.Query(query+` ORDER BY run_id, seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []RunRow
+	for rows.Next() {
+		var r RunRow
+		if err := rows.Scan(&r.RunID, &r.Step, &r.Mean, &r.Variance, &r.Entropy, &r.Components, &r.Params); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+func (s *StatsDB) Close() error {
+	// write the buffered rows and close the database if open, Record must not be called anymore
+	// the first write error is returned
+	if s.db == nil {
+		return nil
+	}
+	close(s.rows)
+	err := <-s.done
+	return errors.Join(err, s.db.Close())
+}
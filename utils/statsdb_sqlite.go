@@ -0,0 +1,6 @@
+//go:build sqlite
+
+package utils
+
+// pure Go SQLite driver of the stats database
+import _ "modernc.org/sqlite"
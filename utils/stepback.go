@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"gonum.org/v1/gonum/mat"
+)
+
+// a state kept for StepBack, with the translation it was drawn at
+type historyEntry struct {
+	A                *mat.Dense
+	offsetX, offsetY int
+}
+
+func (c *Config) pushHistory() {
+	// keep the current state in the ring buffer of the last HistoryDepth states
+	// the matrix itself is kept as Grow replaces A by a new one instead of modifying it
+	if len(c.history) != c.HistoryDepth {
+		c.history = make([]historyEntry, c.HistoryDepth)
+		c.historyNext, c.historyCount = 0, 0
+	}
+	c.history[c.historyNext] = historyEntry{A: c.A, offsetX: c.offsetX, offsetY: c.offsetY}
+	c.historyNext = (c.historyNext + 1) % c.HistoryDepth
+	if c.historyCount < c.HistoryDepth {
+		c.historyCount++
+	}
+}
+
+func (c *Config) StepBack() bool {
+	// restore the state before the last update and its translation, false if there is none left
+	if c.historyCount == 0 || len(c.history) == 0 {
+		return false
+	}
+	c.historyNext = mod(c.historyNext-1, len(c.history))
+	entry := c.history[c.historyNext]
+	c.A = entry.A
+	c.OffsetX, c.OffsetY = entry.offsetX, entry.offsetY
+	c.offsetX, c.offsetY = entry.offsetX, entry.offsetY
+	c.history[c.historyNext] = historyEntry{}
+	c.historyCount--
+	c.Step--
+	return true
+}
+
+func (c *Config) ClearHistory() {
+	// forget the states kept for StepBack
+	c.history = nil
+	c.historyNext, c.historyCount = 0, 0
+}
+
+func (c *Config) History() []*mat.Dense {
+	// states kept for StepBack, the oldest first
+	states := make([]*mat.Dense, 0, c.historyCount)
+	for k := c.historyCount; k > 0; k-- {
+		states = append(states, c.history[mod(c.historyNext-k, len(c.history))].A)
+	}
+	return states
+}
+
+func (c *Config) SetHistory(states []*mat.Dense) {
+	// replace the states kept for StepBack by these ones, the oldest first
+	// HistoryDepth grows if needed to keep them all, they are taken as drawn at the current translation
+	c.ClearHistory()
+	if len(states) > c.HistoryDepth {
+		c.HistoryDepth = len(states)
+	}
+	A := c.A
+	for _, state := range states {
+		c.A = state
+		c.pushHistory()
+	}
+	c.A = A
+}
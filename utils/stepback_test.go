@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestStepBackRestoresOffset(t *testing.T) {
+	// stepping back over a translated update gives the state and the translation before it
+	c := newTestConfig(t, 128, 1)
+	c.HistoryDepth = 4
+	c.Update()
+	before := mat.DenseCopyOf(c.A)
+	c.OffsetX, c.OffsetY = 5, 7
+	c.Update()
+	if !c.StepBack() {
+		t.Fatal("no previous state kept")
+	}
+	if c.OffsetX != 0 || c.OffsetY != 0 {
+		t.Fatalf("offset (%d, %d) after the step back, want (0, 0)", c.OffsetX, c.OffsetY)
+	}
+	if !mat.Equal(c.A, before) {
+		t.Fatal("the state before the update is not restored")
+	}
+	// the next update starts again from the restored translation
+	c.Update()
+	again := newTestConfig(t, 128, 1)
+	again.Update()
+	again.Update()
+	if !mat.Equal(c.A, again.A) {
+		t.Fatal("the update after the step back is translated")
+	}
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"fmt"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func rotate90(m *mat.Dense) *mat.Dense {
+	// quarter turn of a matrix, its dimensions are swapped
+	r, c := m.Dims()
+	rotated := mat.NewDense(c, r, nil)
+	rotated.Apply(func(i, j int, _ float64) float64 {
+		return m.At(r-1-j, i)
+	}, rotated)
+	return rotated
+}
+
+func (c *Config) transformState(transform func(*mat.Dense) *mat.Dense) {
+	// apply a geometric transformation to the state, the spatial maps and the mask
+	// the kernel FFT is computed again when the world dimensions change
+	h, w := c.A.Dims()
+	c.A = transform(c.A)
+	if c.MuMap != nil {
+		c.MuMap = transform(c.MuMap)
+	}
+	if c.SigmaMap != nil {
+		c.SigmaMap = transform(c.SigmaMap)
+	}
+	if c.Mask != nil {
+		c.Mask = transform(c.Mask)
+	}
+	if nh, nw := c.A.Dims(); nh != h || nw != w {
+		c.ClearHistory()
+		c.ComputeKernel()
+	}
+}
+
+func RotateState(c *Config, degrees int) error {
+	// rotate the state by 90, 180 or 270 degrees, swapping the world dimensions for 90 and 270
+	turns := 0
+	switch degrees {
+	case 90:
+		turns = 1
+	case 180:
+		turns = 2
+	case 270:
+		turns = 3
+	default:
+		return fmt.Errorf("rotation of %d degrees: only 90, 180 and 270 are supported", degrees)
+	}
+	c.transformState(func(m *mat.Dense) *mat.Dense {
+		for k := 0; k < turns; k++ {
+			m = rotate90(m)
+		}
+		return m
+	})
+	return nil
+}
+
+func TransposeState(c *Config) {
+	// mirror the state along its diagonal, swapping the world dimensions
+	c.transformState(func(m *mat.Dense) *mat.Dense {
+		return mat.DenseCopyOf(m.T())
+	})
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parameters that the simulation cannot run with, every violation is listed
+type ConfigError struct {
+	Violations []string
+}
+
+func (e *ConfigError) Error() string {
+	// one violation per line
+	return "invalid parameters:\n  - " + strings.Join(e.Violations, "\n  - ")
+}
+
+func ValidateConfig(c *Config) error {
+	// check that R, T and Sigma are positive, that Mu is between 0 and 1, that there is at least
+	// one Beta value, all of them between 0 and 1, that the world is wider than the kernel
+	// and that the hex grid kernel is not stretched, which it does not support
+	// InitState fills any world passing these checks, however small or stretched
+	// the error is a *ConfigError, nil when the config is valid
+	h, w := 0, 0
+	if c.A != nil {
+		h, w = c.A.Dims()
+	}
+	violations := parameterViolations(h, w, c.R, c.T, c.Mu, c.Sigma, c.Beta)
+	if c.GridType == GridHex && c.KernelAspect != 0 && c.KernelAspect != 1 {
+		violations = append(violations, fmt.Sprintf("the hex grid kernel can not be stretched, got a kernel aspect of %g", c.KernelAspect))
+	}
+	return configError(violations)
+}
+
+func (p Params) Validate() error {
+	// same checks as ValidateConfig, before building the config
+	return configError(parameterViolations(p.Height, p.Width, p.R, p.T, p.Mu, p.Sigma, p.Beta))
+}
+
+func configError(violations []string) error {
+	// *ConfigError listing the violations, nil without any
+	if len(violations) > 0 {
+		return &ConfigError{Violations: violations}
+	}
+	return nil
+}
+
+func parameterViolations(h, w int, R, T, Mu, Sigma float64, Beta []float64) []string {
+	// list the violations, the negated comparisons also catch NaN
+	var violations []string
+	if !(R > 0) {
+		violations = append(violations, fmt.Sprintf("R must be positive, got %g", R))
+	}
+	if !(T > 0) {
+		violations = append(violations, fmt.Sprintf("T must be positive, got %g", T))
+	}
+	if !(Mu > 0 && Mu < 1) {
+		violations = append(violations, fmt.Sprintf("Mu must be between 0 and 1 (excluded), got %g", Mu))
+	}
+	if !(Sigma > 0) {
+		violations = append(violations, fmt.Sprintf("Sigma must be positive, got %g", Sigma))
+	}
+	if len(Beta) == 0 {
+		violations = append(violations, "Beta needs at least one value")
+	}
+	for k, b := range Beta {
+		if !(b >= 0 && b <= 1) {
+			violations = append(violations, fmt.Sprintf("Beta values must be between 0 and 1, got %g at position %d", b, k+1))
+		}
+	}
+	if R > 0 && (float64(h) <= 2*R || float64(w) <= 2*R) {
+		violations = append(violations, fmt.Sprintf("the world (%dx%d) must be larger than the kernel diameter 2R = %g", h, w, 2*R))
+	}
+	return violations
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestValidParamsRun(t *testing.T) {
+	// every world size passing the validation builds and updates, down to just larger than the kernel
+	for _, size := range [][2]int{{64, 64}, {512, 256}, {256, 512}, {27, 27}, {27, 200}, {3, 3}} {
+		for _, R := range []float64{1, 13} {
+			p := Params{Width: size[1], Height: size[0], R: R, T: 10, Mu: 0.15, Sigma: 0.015, Beta: []float64{1, 0.5}}
+			if p.Validate() != nil {
+				continue
+			}
+			c, err := p.NewConfig(0)
+			if err != nil {
+				t.Fatalf("%dx%d, R=%g: %v", size[0], size[1], R, err)
+			}
+			c.Update()
+		}
+	}
+}
+
+func TestParamsViolations(t *testing.T) {
+	// every invalid parameter is listed
+	valid := Params{Width: 64, Height: 64, R: 13, T: 10, Mu: 0.15, Sigma: 0.015, Beta: []float64{1}}
+	cases := []struct {
+		name       string
+		change     func(p *Params)
+		violations int
+	}{
+		{"valid", func(p *Params) {}, 0},
+		{"non-square valid", func(p *Params) { p.Width, p.Height = 512, 256 }, 0},
+		{"world as wide as the kernel", func(p *Params) { p.Width = 26 }, 1},
+		{"NaN Mu and negative Sigma", func(p *Params) { p.Mu, p.Sigma = math.NaN(), -1 }, 2},
+		{"no beta", func(p *Params) { p.Beta = nil }, 1},
+		{"beta above 1", func(p *Params) { p.Beta = []float64{1, 2} }, 1},
+		{"zero R and T", func(p *Params) { p.R, p.T = 0, 0 }, 2},
+	}
+	for _, test := range cases {
+		p := valid
+		test.change(&p)
+		err := p.Validate()
+		var invalid *ConfigError
+		switch {
+		case test.violations == 0 && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.violations > 0 && !errors.As(err, &invalid):
+			t.Errorf("%s: error %v, want a *ConfigError", test.name, err)
+		case test.violations > 0 && len(invalid.Violations) != test.violations:
+			t.Errorf("%s: %d violations, want %d: %v", test.name, len(invalid.Violations), test.violations, invalid.Violations)
+		}
+	}
+}